@@ -0,0 +1,264 @@
+// Package cfg rebuilds the control flow graph of a program from the 68000
+// assembly text the compilers emit, and writes it out as a Graphviz DOT file.
+// It works purely from the instruction stream, so any chapter can use it by
+// pointing util.Tee at a Graph while it compiles.
+package cfg
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Edge Kinds
+const (
+	Taken       = "taken"
+	FallThrough = "fall-through"
+	Table       = "table"
+)
+
+// Block is a Basic Block
+type Block struct {
+	Name   string
+	Labels []string
+	Code   []string
+	Succ   []Edge
+}
+
+// Edge is a Control Flow Edge Between Two Blocks
+type Edge struct {
+	To   *Block
+	Kind string
+}
+
+// Graph is a Control Flow Graph Built from Emitted Assembly
+type Graph struct {
+	Blocks []*Block
+	line   string
+	cur    *Block
+	ended  bool
+}
+
+// New Creates an Empty Graph
+func New() *Graph {
+	return &Graph{}
+}
+
+// Write Accepts Assembly Text as it is Emitted
+// Lines end with a CR, as written by util, or with a LF.
+func (g *Graph) Write(p []byte) (int, error) {
+	for _, r := range string(p) {
+		if r == 0x0D || r == 0x0A {
+			g.addLine(g.line)
+			g.line = ""
+		} else {
+			g.line += string(r)
+		}
+	}
+	return len(p), nil
+}
+
+// addLine sorts a line of output into labels and instructions
+// Anything else, such as headers, data and error messages, is ignored.
+func (g *Graph) addLine(s string) {
+	switch {
+	case IsLabel(s):
+		label := strings.TrimSuffix(s, ":")
+		if g.cur == nil || len(g.cur.Code) > 0 || g.ended {
+			g.newBlock()
+		}
+		g.cur.Labels = append(g.cur.Labels, label)
+		if len(g.cur.Labels) == 1 {
+			g.cur.Name = label
+		}
+	case strings.HasPrefix(s, "\t"):
+		inst := strings.TrimSpace(s)
+		if inst == "" {
+			return
+		}
+		if g.cur == nil || g.ended {
+			g.newBlock()
+		}
+		g.cur.Code = append(g.cur.Code, inst)
+		op, _ := Split(inst)
+		g.ended = IsBranch(op) || IsExit(op)
+	}
+}
+
+// newBlock starts a new basic block
+func (g *Graph) newBlock() {
+	g.cur = &Block{Name: "B" + strconv.Itoa(len(g.Blocks)+1)}
+	g.Blocks = append(g.Blocks, g.cur)
+	g.ended = false
+}
+
+// IsLabel Recognizes a Line Holding Only a Label
+func IsLabel(s string) bool {
+	if !strings.HasSuffix(s, ":") || len(s) < 2 {
+		return false
+	}
+	for i, r := range strings.TrimSuffix(s, ":") {
+		isAlpha := (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || r == '_'
+		if !isAlpha && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Split Splits an Instruction into its Opcode and Operands
+func Split(inst string) (op string, args string) {
+	op = inst
+	if i := strings.IndexAny(inst, " \t"); i >= 0 {
+		op, args = inst[:i], strings.TrimSpace(inst[i:])
+	}
+	return strings.ToUpper(op), args
+}
+
+// IsBranch Recognizes an Instruction that Transfers Control to a Label
+func IsBranch(op string) bool {
+	return op == "JMP" || op == "DBRA" || (strings.HasPrefix(op, "B") &&
+		op != "BSR" && !strings.HasPrefix(op, "BCHG") &&
+		!strings.HasPrefix(op, "BCLR") && !strings.HasPrefix(op, "BSET") &&
+		!strings.HasPrefix(op, "BTST"))
+}
+
+// IsExit Recognizes an Instruction that Never Falls Through
+func IsExit(op string) bool {
+	return op == "RTS" || op == "RTE" || op == "END"
+}
+
+// IsData Recognizes a Block that Holds a Jump Table Rather than Code
+func IsData(b *Block) bool {
+	if len(b.Code) == 0 {
+		return false
+	}
+	for _, inst := range b.Code {
+		if op, _ := Split(inst); !strings.HasPrefix(op, "DC") {
+			return false
+		}
+	}
+	return true
+}
+
+// Link Works Out the Successors of Every Block
+func (g *Graph) Link() {
+	labels := make(map[string]*Block)
+	for _, b := range g.Blocks {
+		for _, l := range b.Labels {
+			labels[l] = b
+		}
+	}
+	for i, b := range g.Blocks {
+		b.Succ = nil
+		if IsData(b) {
+			continue
+		}
+		var next *Block
+		for _, n := range g.Blocks[i+1:] {
+			if !IsData(n) {
+				next = n
+				break
+			}
+		}
+		fall := true
+		if len(b.Code) > 0 {
+			op, args := Split(b.Code[len(b.Code)-1])
+			switch {
+			case IsExit(op):
+				fall = false
+			case op == "JMP":
+				fall = false
+				b.Succ = append(b.Succ, tableEdges(labels, args)...)
+			case op == "BRA":
+				fall = false
+				b.Succ = addEdge(b.Succ, labels, args, Taken)
+			case op == "DBRA":
+				b.Succ = addEdge(b.Succ, labels, args[strings.Index(args, ",")+1:],
+					Taken)
+			case IsBranch(op):
+				b.Succ = addEdge(b.Succ, labels, args, Taken)
+			}
+		}
+		if fall && next != nil {
+			b.Succ = append(b.Succ, Edge{next, FallThrough})
+		}
+	}
+}
+
+// addEdge adds an edge to the block posted under a label, if there is one
+func addEdge(succ []Edge, labels map[string]*Block, l string, kind string) []Edge {
+	if to, ok := labels[strings.TrimSpace(l)]; ok {
+		succ = append(succ, Edge{to, kind})
+	}
+	return succ
+}
+
+// tableEdges follows an indexed JMP through the DC.W entries of its table
+func tableEdges(labels map[string]*Block, args string) (succ []Edge) {
+	t, ok := labels[strings.SplitN(args, "(", 2)[0]]
+	if !ok || !IsData(t) {
+		return
+	}
+	seen := make(map[*Block]bool)
+	for _, inst := range t.Code {
+		_, entry := Split(inst)
+		target := strings.SplitN(entry, "-", 2)[0]
+		if to, ok := labels[target]; ok && !seen[to] {
+			seen[to] = true
+			succ = append(succ, Edge{to, Table})
+		}
+	}
+	return
+}
+
+// quote escapes a string for use as a DOT label
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// WriteDOT Writes the Graph in Graphviz DOT Format
+func (g *Graph) WriteDOT(w io.Writer) error {
+	g.Link()
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph CFG {\n")
+	bw.WriteString("\tnode [shape=box, fontname=\"Courier\"];\n")
+	for _, b := range g.Blocks {
+		if IsData(b) {
+			continue
+		}
+		text := ""
+		for _, l := range b.Labels {
+			text += l + ":\\l"
+		}
+		for _, inst := range b.Code {
+			text += "    " + strings.ReplaceAll(inst, `\`, `\\`) + "\\l"
+		}
+		bw.WriteString("\t" + quote(b.Name) + " [label=\"" +
+			strings.ReplaceAll(text, `"`, `\"`) + "\"];\n")
+	}
+	for _, b := range g.Blocks {
+		for _, e := range b.Succ {
+			bw.WriteString("\t" + quote(b.Name) + " -> " + quote(e.To.Name) +
+				" [label=" + quote(e.Kind) + "];\n")
+		}
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// WriteFile Writes the Graph to a DOT File
+func (g *Graph) WriteFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := g.WriteDOT(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
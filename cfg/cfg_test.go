@@ -0,0 +1,142 @@
+package cfg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// build feeds lines of assembly to a new graph and links it
+func build(lines ...string) *Graph {
+	g := New()
+	g.Write([]byte(strings.Join(lines, "\r") + "\r"))
+	g.Link()
+	return g
+}
+
+// succ lists the successors of a block as name/kind pairs
+func succ(b *Block) (s []string) {
+	for _, e := range b.Succ {
+		s = append(s, e.To.Name+"/"+e.Kind)
+	}
+	return
+}
+
+func TestLink(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  map[string][]string
+	}{
+		{
+			"fall-through",
+			[]string{"\t MOVE #1,D0", "L1:", "\t RTS"},
+			map[string][]string{
+				"B1": {"L1/" + FallThrough},
+				"L1": nil,
+			},
+		},
+		{
+			"conditional branch",
+			[]string{"L1:", "\t TST D0", "\t BEQ L2", "\t CLR D0", "L2:", "\t RTS"},
+			map[string][]string{
+				"L1": {"L2/" + Taken, "B2/" + FallThrough},
+				"B2": {"L2/" + FallThrough},
+				"L2": nil,
+			},
+		},
+		{
+			"loop",
+			[]string{"L1:", "\t BSR X", "\t BRA L1"},
+			map[string][]string{
+				"L1": {"L1/" + Taken},
+			},
+		},
+		{
+			"jump table",
+			[]string{"\t JMP L9(PC,D0.W)", "L9:", "\t DC.W L2-L9",
+				"\t DC.W L3-L9", "\t DC.W L2-L9", "L2:", "\t RTS", "L3:", "\t RTS"},
+			map[string][]string{
+				"B1": {"L2/" + Table, "L3/" + Table},
+				"L9": nil,
+				"L2": nil,
+				"L3": nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		g := build(tt.lines...)
+		if len(g.Blocks) != len(tt.want) {
+			t.Errorf("%s: %d blocks, want %d", tt.name, len(g.Blocks), len(tt.want))
+			continue
+		}
+		for _, b := range g.Blocks {
+			got := strings.Join(succ(b), " ")
+			if want := strings.Join(tt.want[b.Name], " "); got != want {
+				t.Errorf("%s: successors of %s = %q, want %q", tt.name, b.Name,
+					got, want)
+			}
+		}
+	}
+}
+
+func TestIsLabel(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"L1:", true},
+		{"MAIN:", true},
+		{"_x:", true},
+		{"L1", false},
+		{":", false},
+		{"1L:", false},
+		{"A:\tDC 0", false},
+		{"Error: x", false},
+	}
+	for _, tt := range tests {
+		if got := IsLabel(tt.s); got != tt.want {
+			t.Errorf("IsLabel(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestIsBranch(t *testing.T) {
+	tests := []struct {
+		op   string
+		want bool
+	}{
+		{"BRA", true},
+		{"BEQ", true},
+		{"DBRA", true},
+		{"JMP", true},
+		{"BSR", false},
+		{"BTST", false},
+		{"BSET", false},
+		{"MOVE", false},
+	}
+	for _, tt := range tests {
+		if got := IsBranch(tt.op); got != tt.want {
+			t.Errorf("IsBranch(%q) = %v, want %v", tt.op, got, tt.want)
+		}
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := New()
+	g.Write([]byte("L1:\r\t BEQ L1\r\t RTS\r"))
+	var buf bytes.Buffer
+	if err := g.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"digraph CFG {",
+		`"L1" -> "L1" [label="taken"];`,
+		`"L1" -> "B2" [label="fall-through"];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteDOT output lacks %q:\n%s", want, out)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/dcw303/crenshaw-go/number"
 	"github.com/dcw303/crenshaw-go/util"
 )
 
@@ -93,13 +94,11 @@ func GetName() (token string) {
 
 // GetNum Gets a Number
 func GetNum() (num string) {
-	if !IsDigit(Look) {
-		Expected("Integer")
-	}
-	for IsDigit(Look) {
-		num += string(Look)
-		GetChar()
+	val, err := number.Scan(func() rune { return Look }, GetChar, number.Word)
+	if err != nil {
+		Abort(err.Error())
 	}
+	num = strconv.FormatInt(val, 10)
 	SkipWhite()
 	return
 }
@@ -0,0 +1,256 @@
+package interpret
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The interpreter above reads its input one keystroke at a time and keeps its
+// variables in the package level Table, so it can only ever run one program at
+// a time through Go(). The functions in this file implement the same
+// expression grammar over a string instead, without touching any package
+// state, so that the evaluator can be embedded in other programs.
+//
+// As with GetName, variable names are case-insensitive, so binding both x and
+// X is an error. A variable that has no binding evaluates to zero, just as it
+// does in Table.
+
+// Program is a Compiled Expression that can be Evaluated Many Times
+type Program struct {
+	src  string
+	root evalFunc
+}
+
+// evalFunc evaluates a compiled node against a set of variable bindings
+type evalFunc func(vars map[string]int) (int, error)
+
+// ErrDivideByZero is Returned when an Expression Divides by Zero
+var ErrDivideByZero = errors.New("Division by Zero")
+
+// BindingError Reports a Variable Bound More Than Once in Different Cases
+type BindingError struct {
+	Name string
+}
+
+func (e *BindingError) Error() string {
+	return "Variable " + e.Name + " is Bound More Than Once"
+}
+
+// SyntaxError Reports Where an Expression Failed to Parse
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return "Error at position " + strconv.Itoa(e.Pos) + ": " + e.Msg
+}
+
+// compiler holds the lookahead state for a single call to Compile
+type compiler struct {
+	src  []rune
+	pos  int
+	look rune
+}
+
+// Compile Parses an Expression Once so it can be Evaluated Repeatedly
+func Compile(src string) (p *Program, err error) {
+	c := &compiler{src: []rune(src)}
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			p, err = nil, se
+		}
+	}()
+	c.getChar()
+	c.skipWhite()
+	root := c.expression()
+	if c.look != 0 {
+		c.expected("End of Expression")
+	}
+	return &Program{src: src, root: root}, nil
+}
+
+// MustCompile is Like Compile but Panics if the Expression is Invalid
+func MustCompile(src string) *Program {
+	p, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String Returns the Source Text of the Program
+func (p *Program) String() string {
+	return p.src
+}
+
+// Eval Evaluates the Program Against a Set of Variable Bindings
+// It is safe to call Eval on the same Program from multiple goroutines.
+func (p *Program) Eval(vars map[string]int) (int, error) {
+	folded := make(map[string]int, len(vars))
+	for name, value := range vars {
+		name = strings.ToUpper(name)
+		if _, ok := folded[name]; ok {
+			return 0, &BindingError{Name: name}
+		}
+		folded[name] = value
+	}
+	return p.root(folded)
+}
+
+// Eval Compiles and Evaluates an Expression in One Step
+func Eval(src string, vars map[string]int) (int, error) {
+	p, err := Compile(src)
+	if err != nil {
+		return 0, err
+	}
+	return p.Eval(vars)
+}
+
+// getChar reads the next character of the source, or 0 at the end
+func (c *compiler) getChar() {
+	if c.pos < len(c.src) {
+		c.look = c.src[c.pos]
+		c.pos++
+	} else {
+		c.look = 0
+		c.pos = len(c.src) + 1
+	}
+}
+
+// abort stops compilation with a syntax error at the lookahead character
+func (c *compiler) abort(s string) {
+	panic(&SyntaxError{Pos: c.pos, Msg: s})
+}
+
+// expected reports what was expected
+func (c *compiler) expected(s string) {
+	c.abort(s + " Expected")
+}
+
+// skipWhite skips over white space, including newlines
+func (c *compiler) skipWhite() {
+	for IsWhite(c.look) || c.look == 0x0D || c.look == 0x0A {
+		c.getChar()
+	}
+}
+
+// match matches a specific input character
+func (c *compiler) match(x rune) {
+	if c.look != x {
+		c.expected(strconv.QuoteRuneToASCII(x))
+	}
+	c.getChar()
+	c.skipWhite()
+}
+
+// getName gets an identifier
+func (c *compiler) getName() (token string) {
+	if !IsAlpha(c.look) {
+		c.expected("Name")
+	}
+	for IsAlNum(c.look) {
+		token += string(unicode.ToUpper(c.look))
+		c.getChar()
+	}
+	c.skipWhite()
+	return
+}
+
+// getNum gets a number
+func (c *compiler) getNum() (value int) {
+	if !IsDigit(c.look) {
+		c.expected("Integer")
+	}
+	for IsDigit(c.look) {
+		digit, err := strconv.Atoi(string(c.look))
+		if err != nil {
+			c.expected("Integer")
+		}
+		value = 10*value + digit
+		c.getChar()
+	}
+	c.skipWhite()
+	return
+}
+
+// factor compiles a math factor
+func (c *compiler) factor() evalFunc {
+	switch {
+	case c.look == '(':
+		c.match('(')
+		value := c.expression()
+		c.match(')')
+		return value
+	case IsAlpha(c.look):
+		name := c.getName()
+		return func(vars map[string]int) (int, error) {
+			return vars[name], nil
+		}
+	default:
+		value := c.getNum()
+		return func(map[string]int) (int, error) {
+			return value, nil
+		}
+	}
+}
+
+// term compiles a math term
+func (c *compiler) term() evalFunc {
+	value := c.factor()
+	for strings.ContainsRune("*/", c.look) {
+		op := c.look
+		c.match(op)
+		value = binary(op, value, c.factor())
+	}
+	return value
+}
+
+// expression compiles a math expression
+func (c *compiler) expression() evalFunc {
+	var value evalFunc
+	if IsAddOp(c.look) {
+		value = func(map[string]int) (int, error) { return 0, nil }
+	} else {
+		value = c.term()
+	}
+	for IsAddOp(c.look) {
+		op := c.look
+		c.match(op)
+		value = binary(op, value, c.term())
+	}
+	return value
+}
+
+// binary combines two compiled operands with an arithmetic operator
+func binary(op rune, left, right evalFunc) evalFunc {
+	return func(vars map[string]int) (int, error) {
+		l, err := left(vars)
+		if err != nil {
+			return 0, err
+		}
+		r, err := right(vars)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '+':
+			return l + r, nil
+		case '-':
+			return l - r, nil
+		case '*':
+			return l * r, nil
+		default:
+			if r == 0 {
+				return 0, ErrDivideByZero
+			}
+			return l / r, nil
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package interpret
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		vars map[string]int
+		want int
+	}{
+		{"1", nil, 1},
+		{"123", nil, 123},
+		{"1+2*3", nil, 7},
+		{"(1+2)*3", nil, 9},
+		{"7/2", nil, 3},
+		{"-5+2", nil, -3},
+		{"10-4-3", nil, 3},
+		{" a + b ", map[string]int{"a": 2, "B": 3}, 5},
+		{"total*2", map[string]int{"TOTAL": 21}, 42},
+		{"x", nil, 0},
+	}
+	for _, tt := range tests {
+		got, err := Eval(tt.src, tt.vars)
+		if err != nil {
+			t.Errorf("Eval(%q) error: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		vars map[string]int
+		pos  int // position of a syntax error, or 0 for another error
+	}{
+		{"", nil, 1},
+		{"1+", nil, 3},
+		{"(1", nil, 3},
+		{"1 2", nil, 3},
+		{"1/x", nil, 0},
+		{"x", map[string]int{"x": 1, "X": 2}, 0},
+	}
+	for _, tt := range tests {
+		_, err := Eval(tt.src, tt.vars)
+		if err == nil {
+			t.Errorf("Eval(%q) succeeded, want an error", tt.src)
+			continue
+		}
+		var se *SyntaxError
+		if errors.As(err, &se) != (tt.pos != 0) {
+			t.Errorf("Eval(%q) error = %v", tt.src, err)
+		} else if se != nil && se.Pos != tt.pos {
+			t.Errorf("Eval(%q) error at %d, want %d", tt.src, se.Pos, tt.pos)
+		}
+	}
+	if _, err := Eval("1/x", nil); err != ErrDivideByZero {
+		t.Errorf("Eval(1/x) error = %v, want %v", err, ErrDivideByZero)
+	}
+	var be *BindingError
+	_, err := Eval("x", map[string]int{"x": 1, "X": 2})
+	if !errors.As(err, &be) || be.Name != "X" {
+		t.Errorf("Eval with x and X bound: error = %v", err)
+	}
+}
+
+func TestProgramConcurrent(t *testing.T) {
+	p := MustCompile("a*a+b")
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				got, err := p.Eval(map[string]int{"a": i, "b": j})
+				if err != nil || got != i*i+j {
+					t.Errorf("Eval(a=%d, b=%d) = %d, %v", i, j, got, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
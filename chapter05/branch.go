@@ -5,7 +5,11 @@ while: awjeke
 loop: paibejeke
 repeat until: rauke
 for: afi=bece
+for step: afi=>:2bece
+for downto: afi=<:1bece
 do: dajke
+case: a#1,3:a5..7:xoyee
+break/continue: @awpxnyb@aeee
 */
 
 package branch
@@ -14,6 +18,7 @@ import (
 	"strconv"
 	"unicode"
 
+	"github.com/dcw303/crenshaw-go/cfg"
 	"github.com/dcw303/crenshaw-go/util"
 )
 
@@ -23,6 +28,35 @@ var Look rune
 // LCount is a Label Counter
 var LCount int
 
+// CFGFile Names a Graphviz DOT File to Receive the Control Flow Graph
+// The graph is only built when this is set.
+var CFGFile string
+
+// LoopContext holds the Labels that BREAK and CONTINUE Can Jump To
+// Stack is the number of bytes the loop keeps pushed while its body runs.
+type LoopContext struct {
+	Name     rune
+	Exit     string
+	Continue string
+	Stack    int
+}
+
+// Loops is the Stack of Enclosing Loops
+var Loops []LoopContext
+
+// MinJumpTable is the Fewest Case Labels Worth a Jump Table
+const MinJumpTable = 4
+
+// MaxJumpTable is the Largest Span of Values Allowed in a Jump Table
+const MaxJumpTable = 256
+
+// CaseLabel is a Constant or Range Selecting an Arm of a CASE
+type CaseLabel struct {
+	Low    int
+	High   int
+	Target string
+}
+
 // GetChar Reads New Character From Input Stream
 func GetChar() {
 	Look = util.Read()
@@ -125,116 +159,240 @@ func Expression() {
 }
 
 // Block Recognizes and Translates a Statement Block
-func Block(l string) {
+func Block() {
 	for Look != 'e' && Look != 'l' && Look != 'u' {
-		switch Look {
-		case 'i':
-			DoIf(l)
-		case 'w':
-			DoWhile()
-		case 'p':
-			DoLoop()
-		case 'r':
-			DoRepeat()
-		case 'f':
-			DoFor()
-		case 'd':
-			DoDo()
-		case 'b':
-			DoBreak(l)
-		default:
-			Other()
-		}
+		Statement()
+	}
+}
+
+// CaseArm Recognizes and Translates the Statements of a CASE Arm
+// An arm runs up to the next case label, OTHERWISE or END.
+func CaseArm() {
+	for Look != 'e' && Look != 'l' && Look != 'u' && Look != 'o' &&
+		!IsDigit(Look) {
+		Statement()
+	}
+}
+
+// Statement Recognizes and Translates a Single Statement
+func Statement() {
+	switch Look {
+	case 'i':
+		DoIf()
+	case '#':
+		DoCase()
+	case '@':
+		DoNamedLoop()
+	case 'w':
+		DoWhile(0)
+	case 'p':
+		DoLoop(0)
+	case 'r':
+		DoRepeat(0)
+	case 'f':
+		DoFor(0)
+	case 'd':
+		DoDo(0)
+	case 'b':
+		DoBreak()
+	case 'n':
+		DoContinue()
+	default:
+		Other()
 	}
 }
 
 // DoIf Recognizes and Translates an IF Construct
-func DoIf(l string) {
+func DoIf() {
 	Match('i')
 	Condition()
 	l1 := NewLabel()
 	l2 := l1
 	EmitLn("BEQ " + l1)
-	Block(l)
+	Block()
 	if Look == 'l' {
 		Match('l')
 		l2 = NewLabel()
 		EmitLn("BRA " + l2)
 		PostLabel(l1)
-		Block(l)
+		Block()
 	}
 	Match('e')
 	PostLabel(l2)
 }
 
 // DoWhile Parses and Translates a WHILE Statement
-func DoWhile() {
+func DoWhile(name rune) {
 	Match('w')
 	l1 := NewLabel()
 	l2 := NewLabel()
 	PostLabel(l1)
 	Condition()
 	EmitLn("BEQ " + l2)
-	Block(l2)
+	PushLoop(name, l2, l1, 0)
+	Block()
+	PopLoop()
 	Match('e')
 	EmitLn("BRA " + l1)
 	PostLabel(l2)
 }
 
 // DoLoop Parses and Translates a LOOP Statement
-func DoLoop() {
+func DoLoop(name rune) {
 	Match('p')
 	l1 := NewLabel()
 	l2 := NewLabel()
 	PostLabel(l1)
-	Block(l2)
+	PushLoop(name, l2, l1, 0)
+	Block()
+	PopLoop()
 	Match('e')
 	EmitLn("BRA " + l1)
 	PostLabel(l2)
 }
 
 // DoRepeat Parses and Translates a REPEAT Statement
-func DoRepeat() {
+func DoRepeat(name rune) {
 	Match('r')
 	l1 := NewLabel()
 	l2 := NewLabel()
 	PostLabel(l1)
-	Block(l2)
+	PushLoop(name, l2, "", 0)
+	Block()
+	PostContinue(PopLoop())
 	Match('u')
 	Condition()
 	EmitLn("BEQ " + l1)
 	PostLabel(l2)
 }
 
+// ForStep Parses the STEP of a FOR Statement
+// A step written as a single signed digit is a constant and is returned for
+// the code generator to fold in; anything else is evaluated into D0.
+func ForStep() (step int, constant bool) {
+	neg := false
+	if Look == '-' {
+		Match('-')
+		neg = true
+	}
+	if IsDigit(Look) {
+		step = int(GetNum() - '0')
+		if step == 0 {
+			Abort("STEP Must Not Be Zero")
+		}
+		if neg {
+			step = -step
+		}
+		return step, true
+	}
+	Expression()
+	if neg {
+		EmitLn("NEG D0")
+	}
+	return 0, false
+}
+
+// AddStep Adds a Constant Step to the Primary Register
+func AddStep(step int) {
+	switch {
+	case step > 0 && step <= 8:
+		EmitLn("ADDQ #" + strconv.Itoa(step) + ",D0")
+	case step < 0 && step >= -8:
+		EmitLn("SUBQ #" + strconv.Itoa(-step) + ",D0")
+	default:
+		EmitLn("ADD #" + strconv.Itoa(step) + ",D0")
+	}
+}
+
 // DoFor Parses and Translates a FOR Statement
-func DoFor() {
+// TO is written as '>' and DOWNTO as '<', and may be left out to count up by
+// one. A STEP (':') is only recognized after an explicit TO or DOWNTO. No
+// statement or name starts with these, so they can't be misread. The
+// limit and step are evaluated once, before the first test, so an empty range
+// runs the body zero times. A step that would overflow the index ends the loop.
+func DoFor(name rune) {
 	Match('f')
 	l1 := NewLabel()
 	l2 := NewLabel()
-	name := GetName()
+	l3 := NewLabel()
+	index := GetName()
 	Match('=')
 	Expression()
-	EmitLn("SUBQ #1,D0")
-	EmitLn("LEA " + string(name) + "(PC),A0")
+	EmitLn("LEA " + string(index) + "(PC),A0")
 	EmitLn("MOVE D0,(A0)")
+	explicit := false
+	down := false
+	switch Look {
+	case '>':
+		Match('>')
+		explicit = true
+	case '<':
+		Match('<')
+		explicit = true
+		down = true
+	}
 	Expression()
 	EmitLn("MOVE D0,-(SP)")
+	step, constant := 1, true
+	if explicit && Look == ':' {
+		Match(':')
+		step, constant = ForStep()
+	}
+	stack := 2
+	limit := "(SP)"
+	if !constant {
+		if down {
+			EmitLn("NEG D0")
+		}
+		EmitLn("MOVE D0,-(SP)")
+		stack = 4
+		limit = "2(SP)"
+	} else if down {
+		step = -step
+	}
 	PostLabel(l1)
-	EmitLn("LEA " + string(name) + "(PC),A0")
+	EmitLn("LEA " + string(index) + "(PC),A0")
 	EmitLn("MOVE (A0),D0")
-	EmitLn("ADDQ #1,D0")
-	EmitLn("MOVE D0,(A0)")
-	EmitLn("CMP (SP),D0")
-	EmitLn("BGT " + l2)
-	Block(l2)
+	if !constant {
+		l4 := NewLabel()
+		l5 := NewLabel()
+		EmitLn("TST (SP)")
+		EmitLn("BMI " + l4)
+		EmitLn("CMP " + limit + ",D0")
+		EmitLn("BGT " + l2)
+		EmitLn("BRA " + l5)
+		PostLabel(l4)
+		EmitLn("CMP " + limit + ",D0")
+		EmitLn("BLT " + l2)
+		PostLabel(l5)
+	} else if step > 0 {
+		EmitLn("CMP " + limit + ",D0")
+		EmitLn("BGT " + l2)
+	} else {
+		EmitLn("CMP " + limit + ",D0")
+		EmitLn("BLT " + l2)
+	}
+	PushLoop(name, l2, l3, stack)
+	Block()
+	PopLoop()
 	Match('e')
+	PostLabel(l3)
+	EmitLn("LEA " + string(index) + "(PC),A0")
+	EmitLn("MOVE (A0),D0")
+	if constant {
+		AddStep(step)
+	} else {
+		EmitLn("ADD (SP),D0")
+	}
+	EmitLn("BVS " + l2)
+	EmitLn("MOVE D0,(A0)")
 	EmitLn("BRA " + l1)
 	PostLabel(l2)
-	EmitLn("ADDQ #2,SP")
+	EmitLn("ADDQ #" + strconv.Itoa(stack) + ",SP")
 }
 
 // DoDo Parses and Translates a DO Statement
-func DoDo() {
+func DoDo(name rune) {
 	Match('d')
 	l1 := NewLabel()
 	l2 := NewLabel()
@@ -242,7 +400,9 @@ func DoDo() {
 	EmitLn("SUBQ #1,D0")
 	PostLabel(l1)
 	EmitLn("MOVE D0,-(SP)")
-	Block(l2)
+	PushLoop(name, l2, "", 2)
+	Block()
+	PostContinue(PopLoop())
 	EmitLn("MOVE (SP)+,D0")
 	EmitLn("DBRA D0," + l1)
 	EmitLn("SUBQ #2,SP")
@@ -250,14 +410,231 @@ func DoDo() {
 	EmitLn("ADDQ #2,SP")
 }
 
+// CaseConst Gets a Constant Case Label
+func CaseConst() int {
+	return int(GetNum() - '0')
+}
+
+// CaseLabelList Parses the Labels of a CASE Arm
+func CaseLabelList(target string, labels []CaseLabel) []CaseLabel {
+	for {
+		low := CaseConst()
+		high := low
+		if Look == '.' {
+			Match('.')
+			Match('.')
+			high = CaseConst()
+		}
+		if high < low {
+			Abort("Empty Case Range")
+		}
+		for _, c := range labels {
+			if low <= c.High && high >= c.Low {
+				Abort("Duplicate Case Label")
+			}
+		}
+		labels = append(labels, CaseLabel{low, high, target})
+		if Look != ',' {
+			return labels
+		}
+		Match(',')
+	}
+}
+
+// IsDense Decides Whether Case Labels Suit a Jump Table
+func IsDense(labels []CaseLabel) bool {
+	if len(labels) < MinJumpTable {
+		return false
+	}
+	low, high := labels[0].Low, labels[0].High
+	count := 0
+	for _, c := range labels {
+		if c.Low < low {
+			low = c.Low
+		}
+		if c.High > high {
+			high = c.High
+		}
+		count += c.High - c.Low + 1
+	}
+	span := high - low + 1
+	return span <= MaxJumpTable && 2*count >= span
+}
+
+// JumpTable Dispatches on D0 Through an Indexed Table of Offsets
+func JumpTable(labels []CaseLabel, other string) {
+	low, high := labels[0].Low, labels[0].High
+	for _, c := range labels {
+		if c.Low < low {
+			low = c.Low
+		}
+		if c.High > high {
+			high = c.High
+		}
+	}
+	if low != 0 {
+		EmitLn("SUB #" + strconv.Itoa(low) + ",D0")
+	}
+	EmitLn("CMP #" + strconv.Itoa(high-low) + ",D0")
+	EmitLn("BHI " + other)
+	EmitLn("ADD D0,D0")
+	t := NewLabel()
+	EmitLn("MOVE " + t + "(PC,D0.W),D0")
+	EmitLn("JMP " + t + "(PC,D0.W)")
+	PostLabel(t)
+	for v := low; v <= high; v++ {
+		target := other
+		for _, c := range labels {
+			if v >= c.Low && v <= c.High {
+				target = c.Target
+			}
+		}
+		EmitLn("DC.W " + target + "-" + t)
+	}
+}
+
+// CompareChain Dispatches on D0 Through a Sequence of Compares
+func CompareChain(labels []CaseLabel, other string) {
+	for _, c := range labels {
+		if c.Low == c.High {
+			EmitLn("CMP #" + strconv.Itoa(c.Low) + ",D0")
+			EmitLn("BEQ " + c.Target)
+		} else {
+			l := NewLabel()
+			EmitLn("CMP #" + strconv.Itoa(c.Low) + ",D0")
+			EmitLn("BLT " + l)
+			EmitLn("CMP #" + strconv.Itoa(c.High) + ",D0")
+			EmitLn("BLE " + c.Target)
+			PostLabel(l)
+		}
+	}
+	EmitLn("BRA " + other)
+}
+
+// DoCase Parses and Translates a CASE Statement
+// The arms are emitted in source order ahead of the dispatch code, since the
+// labels must all be known before a jump table can be laid out. The selector
+// is left in D0 by Expression and survives the branch over the arms.
+func DoCase() {
+	Match('#')
+	Expression()
+	l1 := NewLabel()
+	l2 := NewLabel()
+	other := l2
+	EmitLn("BRA " + l1)
+	var labels []CaseLabel
+	for IsDigit(Look) {
+		target := NewLabel()
+		labels = CaseLabelList(target, labels)
+		Match(':')
+		PostLabel(target)
+		CaseArm()
+		EmitLn("BRA " + l2)
+	}
+	if Look == 'o' {
+		Match('o')
+		other = NewLabel()
+		PostLabel(other)
+		CaseArm()
+		EmitLn("BRA " + l2)
+	}
+	Match('e')
+	PostLabel(l1)
+	if IsDense(labels) {
+		JumpTable(labels, other)
+	} else {
+		CompareChain(labels, other)
+	}
+	PostLabel(l2)
+}
+
+// DoNamedLoop Parses and Translates a Loop Preceded by a Name
+func DoNamedLoop() {
+	name := LoopName()
+	switch Look {
+	case 'w':
+		DoWhile(name)
+	case 'p':
+		DoLoop(name)
+	case 'r':
+		DoRepeat(name)
+	case 'f':
+		DoFor(name)
+	case 'd':
+		DoDo(name)
+	default:
+		Expected("Loop")
+	}
+}
+
+// LoopName Gets an Optional Loop Name Written as @<name>
+func LoopName() (name rune) {
+	if Look == '@' {
+		Match('@')
+		name = GetName()
+	}
+	return
+}
+
+// PushLoop Opens the Context of a Loop Body
+func PushLoop(name rune, exit string, cont string, stack int) {
+	Loops = append(Loops, LoopContext{name, exit, cont, stack})
+}
+
+// PopLoop Closes the Context of the Innermost Loop Body
+func PopLoop() (c LoopContext) {
+	c = Loops[len(Loops)-1]
+	Loops = Loops[:len(Loops)-1]
+	return
+}
+
+// PostContinue Posts a Continue Label, If Any CONTINUE Asked for One
+func PostContinue(c LoopContext) {
+	if c.Continue != "" {
+		PostLabel(c.Continue)
+	}
+}
+
+// FindLoop Finds the Loop Targeted by a BREAK or CONTINUE
+// The bytes held on the stack by any loops being jumped out of are released
+// before the branch is taken.
+func FindLoop(s string) int {
+	name := LoopName()
+	i := len(Loops) - 1
+	for i >= 0 && name != 0 && Loops[i].Name != name {
+		i--
+	}
+	if i < 0 {
+		if name != 0 {
+			Abort("No loop named " + string(name))
+		}
+		Abort("No loop to " + s)
+	}
+	stack := 0
+	for _, c := range Loops[i+1:] {
+		stack += c.Stack
+	}
+	if stack > 0 {
+		EmitLn("ADDQ #" + strconv.Itoa(stack) + ",SP")
+	}
+	return i
+}
+
 // DoBreak Recognizes and Translates a BREAK
-func DoBreak(l string) {
+func DoBreak() {
 	Match('b')
-	if l != "" {
-		EmitLn("BRA " + l)
-	} else {
-		Abort("No loop to break from")
+	i := FindLoop("break from")
+	EmitLn("BRA " + Loops[i].Exit)
+}
+
+// DoContinue Recognizes and Translates a CONTINUE
+func DoContinue() {
+	Match('n')
+	i := FindLoop("continue")
+	if Loops[i].Continue == "" {
+		Loops[i].Continue = NewLabel()
 	}
+	EmitLn("BRA " + Loops[i].Continue)
 }
 
 // Other Recognizes and Translates an "Other"
@@ -267,7 +644,7 @@ func Other() {
 
 // DoProgram Parses and Translates a Program
 func DoProgram() {
-	Block("")
+	Block()
 	if Look != 'e' {
 		Expected("End")
 	}
@@ -277,11 +654,35 @@ func DoProgram() {
 // Init Initializes
 func Init() {
 	LCount = 1
+	Loops = nil
 	GetChar()
 }
 
+// StartCFG Starts Recording the Control Flow Graph, if One Was Asked For
+func StartCFG() (g *cfg.Graph) {
+	if CFGFile != "" {
+		g = cfg.New()
+		util.Tee = g
+	}
+	return
+}
+
+// WriteCFG Writes the Recorded Control Flow Graph to CFGFile
+func WriteCFG(g *cfg.Graph) {
+	if g == nil {
+		return
+	}
+	util.Tee = nil
+	if err := g.WriteFile(CFGFile); err != nil {
+		Abort(err.Error())
+	}
+}
+
 // Go starts the execution of this chapter
 func Go() {
 	Init()
+	g := StartCFG()
+	defer func() { util.Tee = nil }()
 	DoProgram()
+	WriteCFG(g)
 }
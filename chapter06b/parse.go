@@ -8,6 +8,10 @@ k=3
 ia+j=k
 z=9
 e
+fi=1>k:2
+z=z+i
+e
+f=0
 e
 */
 
@@ -27,6 +31,23 @@ var Look rune
 // LCount is a Label Counter
 var LCount int
 
+// LoopContext holds the Labels that BREAK and CONTINUE Can Jump To
+// Stack is the number of bytes the loop keeps pushed while its body runs.
+type LoopContext struct {
+	Name     rune
+	Exit     string
+	Continue string
+	Stack    int
+}
+
+// Loops is the Stack of Enclosing Loops
+var Loops []LoopContext
+
+// ShortCircuit Selects Short-Circuit Evaluation of & and |
+// When set, the right operand is skipped once the left one decides the
+// result. When clear, both operands are always evaluated and combined.
+var ShortCircuit bool
+
 // GetChar Reads New Character From Input Stream
 func GetChar() {
 	Look = util.Read()
@@ -132,22 +153,28 @@ func EmitLn(s string) {
 }
 
 // Block Recognizes and Translates a Statement Block
-func Block(l string) {
+func Block() {
 	for Look != 'e' && Look != 'l' && Look != 'u' {
 		Fin()
 		switch Look {
 		case 'i':
-			DoIf(l)
+			DoIf()
+		case '@':
+			DoNamedLoop()
 		case 'w':
-			DoWhile()
+			DoWhile(0)
 		case 'p':
-			DoLoop()
+			DoLoop(0)
 		case 'r':
-			DoRepeat()
+			DoRepeat(0)
+		case 'f':
+			DoFor(0)
 		case 'd':
-			DoDo()
+			DoDo(0)
 		case 'b':
-			DoBreak(l)
+			DoBreak()
+		case 'n':
+			DoContinue()
 		case 0X0D:
 			//Do Nothing - This is not in the tutorial but is needed to stop 3 or
 			//more CRs feeding a CR into Other()
@@ -159,92 +186,203 @@ func Block(l string) {
 }
 
 // DoIf Recognizes and Translates an IF Construct
-func DoIf(l string) {
+func DoIf() {
 	Match('i')
 	BoolExpression()
 	l1 := NewLabel()
 	l2 := l1
 	EmitLn("BEQ " + l1)
-	Block(l)
+	Block()
 	if Look == 'l' {
 		Match('l')
 		l2 = NewLabel()
 		EmitLn("BRA " + l2)
 		PostLabel(l1)
-		Block(l)
+		Block()
 	}
 	Match('e')
 	PostLabel(l2)
 }
 
 // DoWhile Parses and Translates a WHILE Statement
-func DoWhile() {
+func DoWhile(name rune) {
 	Match('w')
 	l1 := NewLabel()
 	l2 := NewLabel()
 	PostLabel(l1)
 	BoolExpression()
 	EmitLn("BEQ " + l2)
-	Block(l2)
+	PushLoop(name, l2, l1, 0)
+	Block()
+	PopLoop()
 	Match('e')
 	EmitLn("BRA " + l1)
 	PostLabel(l2)
 }
 
 // DoLoop Parses and Translates a LOOP Statement
-func DoLoop() {
+func DoLoop(name rune) {
 	Match('p')
 	l1 := NewLabel()
 	l2 := NewLabel()
 	PostLabel(l1)
-	Block(l2)
+	PushLoop(name, l2, l1, 0)
+	Block()
+	PopLoop()
 	Match('e')
 	EmitLn("BRA " + l1)
 	PostLabel(l2)
 }
 
 // DoRepeat Parses and Translates a REPEAT Statement
-func DoRepeat() {
+func DoRepeat(name rune) {
 	Match('r')
 	l1 := NewLabel()
 	l2 := NewLabel()
 	PostLabel(l1)
-	Block(l2)
+	PushLoop(name, l2, "", 0)
+	Block()
+	PostContinue(PopLoop())
 	Match('u')
 	BoolExpression()
 	EmitLn("BEQ " + l1)
 	PostLabel(l2)
 }
 
+// ForStep Parses the STEP of a FOR Statement
+// A step written as a single signed digit is a constant and is returned for
+// the code generator to fold in; anything else is evaluated into D0.
+func ForStep() (step int, constant bool) {
+	neg := false
+	if Look == '-' {
+		Match('-')
+		neg = true
+	}
+	if IsDigit(Look) {
+		step = int(GetNum() - '0')
+		if step == 0 {
+			Abort("STEP Must Not Be Zero")
+		}
+		if neg {
+			step = -step
+		}
+		return step, true
+	}
+	Expression()
+	if neg {
+		EmitLn("NEG D0")
+	}
+	return 0, false
+}
+
+// AddStep Adds a Constant Step to the Primary Register
+func AddStep(step int) {
+	switch {
+	case step > 0 && step <= 8:
+		EmitLn("ADDQ #" + strconv.Itoa(step) + ",D0")
+	case step < 0 && step >= -8:
+		EmitLn("SUBQ #" + strconv.Itoa(-step) + ",D0")
+	default:
+		EmitLn("ADD #" + strconv.Itoa(step) + ",D0")
+	}
+}
+
 // DoFor Parses and Translates a FOR Statement
-func DoFor() {
+// TO is written as '>' and DOWNTO as '<', and may be left out to count up by
+// one. A STEP (':') is only recognized after an explicit TO or DOWNTO. No
+// statement or name starts with these, so they can't be misread. The
+// limit and step are evaluated once, before the first test, so an empty range
+// runs the body zero times. A step that would overflow the index ends the loop.
+// FOR is not in the tutorial's version of this section, and was added here: an
+// f now starts a FOR, unless it is followed by =, when it is still an
+// assignment to F.
+func DoFor(name rune) {
 	Match('f')
+	if Look == '=' && name == 0 {
+		AssignTo('F')
+		return
+	}
 	l1 := NewLabel()
 	l2 := NewLabel()
-	name := GetName()
+	l3 := NewLabel()
+	index := GetName()
 	Match('=')
 	Expression()
-	EmitLn("SUBQ #1,D0")
-	EmitLn("LEA " + string(name) + "(PC),A0")
+	EmitLn("LEA " + string(index) + "(PC),A0")
 	EmitLn("MOVE D0,(A0)")
+	explicit := false
+	down := false
+	switch Look {
+	case '>':
+		Match('>')
+		explicit = true
+	case '<':
+		Match('<')
+		explicit = true
+		down = true
+	}
 	Expression()
 	EmitLn("MOVE D0,-(SP)")
+	step, constant := 1, true
+	if explicit && Look == ':' {
+		Match(':')
+		step, constant = ForStep()
+	}
+	stack := 2
+	limit := "(SP)"
+	if !constant {
+		if down {
+			EmitLn("NEG D0")
+		}
+		EmitLn("MOVE D0,-(SP)")
+		stack = 4
+		limit = "2(SP)"
+	} else if down {
+		step = -step
+	}
 	PostLabel(l1)
-	EmitLn("LEA " + string(name) + "(PC),A0")
+	EmitLn("LEA " + string(index) + "(PC),A0")
 	EmitLn("MOVE (A0),D0")
-	EmitLn("ADDQ #1,D0")
-	EmitLn("MOVE D0,(A0)")
-	EmitLn("CMP (SP),D0")
-	EmitLn("BGT " + l2)
-	Block(l2)
+	if !constant {
+		l4 := NewLabel()
+		l5 := NewLabel()
+		EmitLn("TST (SP)")
+		EmitLn("BMI " + l4)
+		EmitLn("CMP " + limit + ",D0")
+		EmitLn("BGT " + l2)
+		EmitLn("BRA " + l5)
+		PostLabel(l4)
+		EmitLn("CMP " + limit + ",D0")
+		EmitLn("BLT " + l2)
+		PostLabel(l5)
+	} else if step > 0 {
+		EmitLn("CMP " + limit + ",D0")
+		EmitLn("BGT " + l2)
+	} else {
+		EmitLn("CMP " + limit + ",D0")
+		EmitLn("BLT " + l2)
+	}
+	PushLoop(name, l2, l3, stack)
+	Block()
+	PopLoop()
 	Match('e')
+	PostLabel(l3)
+	EmitLn("LEA " + string(index) + "(PC),A0")
+	EmitLn("MOVE (A0),D0")
+	if constant {
+		AddStep(step)
+	} else {
+		EmitLn("ADD (SP),D0")
+	}
+	EmitLn("BVS " + l2)
+	EmitLn("MOVE D0,(A0)")
 	EmitLn("BRA " + l1)
 	PostLabel(l2)
-	EmitLn("ADDQ #2,SP")
+	EmitLn("ADDQ #" + strconv.Itoa(stack) + ",SP")
 }
 
 // DoDo Parses and Translates a DO Statement
-func DoDo() {
+func DoDo(name rune) {
 	Match('d')
 	l1 := NewLabel()
 	l2 := NewLabel()
@@ -252,7 +390,9 @@ func DoDo() {
 	EmitLn("SUBQ #1,D0")
 	PostLabel(l1)
 	EmitLn("MOVE D0,-(SP)")
-	Block(l2)
+	PushLoop(name, l2, "", 2)
+	Block()
+	PostContinue(PopLoop())
 	EmitLn("MOVE (SP)+,D0")
 	EmitLn("DBRA D0," + l1)
 	EmitLn("SUBQ #2,SP")
@@ -260,14 +400,98 @@ func DoDo() {
 	EmitLn("ADDQ #2,SP")
 }
 
+// DoNamedLoop Parses and Translates a Loop Preceded by a Name
+func DoNamedLoop() {
+	name := LoopName()
+	switch Look {
+	case 'w':
+		DoWhile(name)
+	case 'p':
+		DoLoop(name)
+	case 'r':
+		DoRepeat(name)
+	case 'f':
+		DoFor(name)
+	case 'd':
+		DoDo(name)
+	default:
+		Expected("Loop")
+	}
+}
+
+// LoopName Gets an Optional Loop Name Written as @<name>
+func LoopName() (name rune) {
+	if Look == '@' {
+		Match('@')
+		name = GetName()
+	}
+	return
+}
+
+// PushLoop Opens the Context of a Loop Body
+func PushLoop(name rune, exit string, cont string, stack int) {
+	Loops = append(Loops, LoopContext{name, exit, cont, stack})
+}
+
+// PopLoop Closes the Context of the Innermost Loop Body
+func PopLoop() (c LoopContext) {
+	c = Loops[len(Loops)-1]
+	Loops = Loops[:len(Loops)-1]
+	return
+}
+
+// PostContinue Posts a Continue Label, If Any CONTINUE Asked for One
+func PostContinue(c LoopContext) {
+	if c.Continue != "" {
+		PostLabel(c.Continue)
+	}
+}
+
+// FindLoop Finds the Loop Targeted by a BREAK or CONTINUE
+// The bytes held on the stack by any loops being jumped out of are released
+// before the branch is taken.
+func FindLoop(s string) int {
+	name := LoopName()
+	i := len(Loops) - 1
+	for i >= 0 && name != 0 && Loops[i].Name != name {
+		i--
+	}
+	if i < 0 {
+		if name != 0 {
+			Abort("No loop named " + string(name))
+		}
+		Abort("No loop to " + s)
+	}
+	stack := 0
+	for _, c := range Loops[i+1:] {
+		stack += c.Stack
+	}
+	if stack > 0 {
+		EmitLn("ADDQ #" + strconv.Itoa(stack) + ",SP")
+	}
+	return i
+}
+
 // DoBreak Recognizes and Translates a BREAK
-func DoBreak(l string) {
+func DoBreak() {
 	Match('b')
-	if l != "" {
-		EmitLn("BRA " + l)
-	} else {
-		Abort("No loop to break from")
+	i := FindLoop("break from")
+	EmitLn("BRA " + Loops[i].Exit)
+}
+
+// DoContinue Recognizes and Translates a CONTINUE
+// An n followed by = is an assignment to N instead.
+func DoContinue() {
+	Match('n')
+	if Look == '=' {
+		AssignTo('N')
+		return
+	}
+	i := FindLoop("continue")
+	if Loops[i].Continue == "" {
+		Loops[i].Continue = NewLabel()
 	}
+	EmitLn("BRA " + Loops[i].Continue)
 }
 
 // Other Recognizes and Translates an "Other"
@@ -277,7 +501,7 @@ func Other() {
 
 // DoProgram Recognizes and Translates a Program
 func DoProgram() {
-	Block("")
+	Block()
 	if Look != 'e' {
 		Expected("END")
 	}
@@ -288,6 +512,10 @@ func DoProgram() {
 func BoolExpression() {
 	BoolTerm()
 	for IsOrOp(Look) {
+		if ShortCircuit && Look == '|' {
+			OrElse()
+			continue
+		}
 		EmitLn("MOVE D0,-(SP)")
 		switch Look {
 		case '|':
@@ -305,6 +533,16 @@ func BoolOr() {
 	EmitLn("OR (SP)+,D0")
 }
 
+// OrElse Recognizes and Translates a Short-Circuit OR
+func OrElse() {
+	Match('|')
+	l := NewLabel()
+	EmitLn("TST D0")
+	EmitLn("BNE " + l)
+	BoolTerm()
+	PostLabel(l)
+}
+
 // BoolXor Recognizes and Translates an Exclusive OR
 func BoolXor() {
 	Match('~')
@@ -334,6 +572,10 @@ func BoolFactor() {
 func BoolTerm() {
 	NotFactor()
 	for Look == '&' {
+		if ShortCircuit {
+			AndThen()
+			continue
+		}
 		EmitLn("MOVE D0, -(SP)")
 		Match('&')
 		NotFactor()
@@ -341,6 +583,16 @@ func BoolTerm() {
 	}
 }
 
+// AndThen Recognizes and Translates a Short-Circuit AND
+func AndThen() {
+	Match('&')
+	l := NewLabel()
+	EmitLn("TST D0")
+	EmitLn("BEQ " + l)
+	NotFactor()
+	PostLabel(l)
+}
+
 // NotFactor Parses and Translates a Boolean Factor with NOT
 func NotFactor() {
 	if Look == '!' {
@@ -528,7 +780,11 @@ func Fin() {
 
 // Assignment Parses and Translates an Assignment Statement
 func Assignment() {
-	name := GetName()
+	AssignTo(GetName())
+}
+
+// AssignTo Translates the Rest of an Assignment Once its Name is Read
+func AssignTo(name rune) {
 	Match('=')
 	BoolExpression()
 	EmitLn("LEA " + string(name) + "(PC),A0")
@@ -538,6 +794,7 @@ func Assignment() {
 // Init Initializes
 func Init() {
 	LCount = 1
+	Loops = nil
 	GetChar()
 }
 
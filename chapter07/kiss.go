@@ -41,6 +41,44 @@ const (
 	Operator
 )
 
+// String Names a Symbol Type
+func (t SymType) String() string {
+	switch t {
+	case IfSym:
+		return "IfSym"
+	case ElseSym:
+		return "ElseSym"
+	case EndIfSym:
+		return "EndIfSym"
+	case EndSym:
+		return "EndSym"
+	case Ident:
+		return "Ident"
+	case Number:
+		return "Number"
+	case Operator:
+		return "Operator"
+	}
+	return "SymType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// Pos is a Position in the Source
+type Pos struct {
+	Line int
+	Col  int
+}
+
+// String Formats a Position as line:col
+func (p Pos) String() string {
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Col)
+}
+
+// LookPos is the Position of the Lookahead Character
+var LookPos = Pos{1, 0}
+
+// TokenPos is the Position Where the Current Token Started
+var TokenPos Pos
+
 // Token is a Token
 var Token SymType
 
@@ -55,7 +93,12 @@ var KWList = []string{"IF", "ELSE", "ENDIF", "END"}
 
 // GetChar Reads New Character From Input Stream
 func GetChar() {
+	if Look == 0x0D {
+		LookPos.Line++
+		LookPos.Col = 0
+	}
 	Look = util.Read()
+	LookPos.Col++
 }
 
 // Error Reports an Error
@@ -184,7 +227,9 @@ func SkipWhite() {
 func Scan() {
 	for Look == 0x0D {
 		Fin()
+		SkipWhite()
 	}
+	TokenPos = LookPos
 	switch {
 	case IsAlpha(Look):
 		GetName()
@@ -228,6 +273,8 @@ func Lookup(table []string, s string, n int) int {
 
 // Init Initializes
 func Init() {
+	Look = 0
+	LookPos = Pos{1, 0}
 	GetChar()
 }
 
@@ -0,0 +1,124 @@
+// Package tokens exposes the KISS scanner of chapter 7 as a stream of tokens,
+// for tools that want to look at the lexical structure of a program.
+package tokens
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/dcw303/crenshaw-go/chapter07"
+	"github.com/dcw303/crenshaw-go/util"
+)
+
+// Token is a Scanned Token
+// Text is the token as it was spelled in the source.
+type Token struct {
+	Kind kiss.SymType
+	Text string
+	Pos  kiss.Pos
+}
+
+// Scanner Iterates Over the Tokens of a Source
+// The KISS scanner keeps its state in package variables, so only one Scanner
+// can be in use at a time.
+type Scanner struct {
+	tok   Token
+	lines []string
+	out   strings.Builder
+	err   error
+	done  bool
+}
+
+// NewScanner Starts Scanning the KISS Source Read from r
+func NewScanner(r io.Reader) *Scanner {
+	s := &Scanner{}
+	src, err := io.ReadAll(r)
+	if err != nil {
+		s.err = err
+		s.done = true
+		return s
+	}
+	text := strings.ReplaceAll(string(src), "\r", "")
+	s.lines = strings.Split(text, "\n")
+	util.Source = strings.NewReader(text)
+	util.Screen = &s.out
+	kiss.Init()
+	return s
+}
+
+// Next Scans the Next Token
+// It returns false at the end of the source, after END has been returned, and
+// at a lexical error, which is then reported by Err.
+func (s *Scanner) Next() bool {
+	if s.done {
+		return false
+	}
+	found := false
+	s.guard(func() {
+		kiss.Scan()
+		if kiss.Value == string(rune(0x1A)) {
+			s.Close()
+			return
+		}
+		s.tok = Token{kiss.Token, s.spelling(), kiss.TokenPos}
+		found = true
+		if kiss.Token == kiss.EndSym {
+			s.Close()
+		}
+	})
+	return found
+}
+
+// guard runs a step of the scanner, stopping the scan if it aborts
+func (s *Scanner) guard(step func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != "Aborted" {
+				panic(r)
+			}
+			msg := strings.TrimSpace(strings.ReplaceAll(s.out.String(), "\r", "\n"))
+			if i := strings.LastIndex(msg, "Error: "); i >= 0 {
+				msg = msg[i+len("Error: "):]
+			}
+			s.err = errors.New(kiss.TokenPos.String() + ": " + msg)
+			s.Close()
+		}
+	}()
+	step()
+}
+
+// spelling returns the source text of the current token
+// The scanner skips the white space after a token, so that is trimmed off.
+func (s *Scanner) spelling() string {
+	from, to := kiss.TokenPos, kiss.LookPos
+	if from.Line < 1 || from.Line > len(s.lines) {
+		return kiss.Value
+	}
+	line := []rune(s.lines[from.Line-1])
+	end := len(line)
+	if to.Line == from.Line && to.Col-1 < end {
+		end = to.Col - 1
+	}
+	if from.Col < 1 || from.Col-1 > end {
+		return kiss.Value
+	}
+	return strings.TrimRight(string(line[from.Col-1:end]), " \t")
+}
+
+// Token Returns the Token Found by the Last Call to Next
+func (s *Scanner) Token() Token {
+	return s.tok
+}
+
+// Err Returns the Error that Stopped the Scan, or nil at the End of the Source
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Close Stops Scanning and Releases the Source
+func (s *Scanner) Close() {
+	s.done = true
+	util.Source = nil
+	util.Screen = nil
+}
@@ -19,6 +19,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/dcw303/crenshaw-go/number"
 	"github.com/dcw303/crenshaw-go/util"
 )
 
@@ -157,14 +158,11 @@ func GetName() {
 
 // GetNum Gets a Number
 func GetNum() {
-	if !IsDigit(Look) {
-		Expected("Integer")
-	}
-	Value = ""
-	for IsDigit(Look) {
-		Value += string(Look)
-		GetChar()
+	val, err := number.Scan(func() rune { return Look }, GetChar, number.Word)
+	if err != nil {
+		Abort(err.Error())
 	}
+	Value = strconv.FormatInt(val, 10)
 	Token = '#'
 	SkipWhite()
 }
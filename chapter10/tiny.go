@@ -21,15 +21,14 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/dcw303/crenshaw-go/number"
+	"github.com/dcw303/crenshaw-go/symtab"
 	"github.com/dcw303/crenshaw-go/util"
 )
 
 // LCount is a Label Counter
 var LCount int
 
-// NEntry is the Next Entry in the Symbol Table
-var NEntry int
-
 // Look is a Lookahead character
 var Look rune
 
@@ -39,14 +38,8 @@ var Token rune
 // Value is an Unencoded Token
 var Value string
 
-// MaxEntry is the number of Entries allowed in the Symbol Table
-const MaxEntry = 100
-
 // ST is the Symbol Table
-var ST []string
-
-// SType is the Symbol Type Table
-var SType []rune
+var ST *symtab.Table
 
 // Definition of Keywords and Token Types
 
@@ -175,28 +168,23 @@ func Lookup(table []string, s string, n int) int {
 }
 
 // Locate Locates a Symbol in Table
-func Locate(n string) int {
-	return Lookup(ST, n, MaxEntry)
+// Returns nil if it's not there.
+func Locate(n string) *symtab.Entry {
+	e, _ := ST.Lookup(n)
+	return e
 }
 
 // InTable Looks for Symbol in Table
 func InTable(n string) bool {
-	// Original code calls Lookup, but I'm using Locate as otherwise it has
-	// no use
-	return Locate(n) != -1
+	return Locate(n) != nil
 }
 
 // AddEntry Adds a New Entry to Symbol Table
 func AddEntry(n string, t rune) {
-	if InTable(n) {
+	_, err := ST.Add(symtab.Entry{Name: n, Kind: symtab.Kind(t)})
+	if err != nil {
 		Abort("Duplicate Identifier " + n)
 	}
-	if NEntry == MaxEntry {
-		Abort("Symbol Table Full")
-	}
-	NEntry++
-	ST[NEntry] = n
-	SType[NEntry] = t
 }
 
 // GetName Gets an Identifier
@@ -214,22 +202,17 @@ func GetName() {
 }
 
 // GetNum Gets a Number
-func GetNum() (val int) {
-	if !IsDigit(Look) {
+func GetNum() int {
+	if !number.IsStart(Look) {
 		Expected("Integer")
 	}
 	NewLine()
-	val = 0
-	for IsDigit(Look) {
-		digit, err := strconv.Atoi(string(Look))
-		if err != nil {
-			panic(err)
-		}
-		val = 10*val + digit
-		GetChar()
+	val, err := number.Scan(func() rune { return Look }, GetChar, number.Word)
+	if err != nil {
+		Abort(err.Error())
 	}
 	SkipWhite()
-	return
+	return int(val)
 }
 
 // Scan Gets an Identifier and Scans it for Keywords
@@ -447,8 +430,12 @@ func Factor() {
 // NegFactor Parses and Translates a Negative Factor
 func NegFactor() {
 	Match('-')
-	if IsDigit(Look) {
-		LoadConst(-GetNum())
+	if number.IsStart(Look) {
+		n, err := number.Negate(int64(GetNum()), number.Word)
+		if err != nil {
+			Abort(err.Error())
+		}
+		LoadConst(int(n))
 	} else {
 		Factor()
 		Negate()
@@ -803,14 +790,7 @@ func Prog() {
 
 // Init Initializes
 func Init() {
-	ST = make([]string, MaxEntry)
-	SType = make([]rune, MaxEntry)
-	for i := 0; i < MaxEntry; i++ {
-		//this is not necessary in Go as empty string is default val for string
-		//slice anyway
-		ST[i] = ""
-		SType[i] = ' '
-	}
+	ST = symtab.New()
 	GetChar()
 	Scan()
 }
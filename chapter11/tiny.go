@@ -22,15 +22,14 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/dcw303/crenshaw-go/number"
+	"github.com/dcw303/crenshaw-go/symtab"
 	"github.com/dcw303/crenshaw-go/util"
 )
 
 // LCount is a Label Counter
 var LCount int
 
-// NEntry is the Next Entry in the Symbol Table
-var NEntry int
-
 // Look is a Lookahead character
 var Look rune
 
@@ -40,14 +39,8 @@ var Token rune
 // Value is an Unencoded Token
 var Value string
 
-// MaxEntry is the number of Entries allowed in the Symbol Table
-const MaxEntry = 100
-
 // ST is the Symbol Table
-var ST []string
-
-// SType is the Symbol Type Table
-var SType []rune
+var ST *symtab.Table
 
 // Definition of Keywords and Token Types
 
@@ -167,15 +160,15 @@ func Lookup(table []string, s string, n int) int {
 }
 
 // Locate Locates a Symbol in Table
-func Locate(n string) int {
-	return Lookup(ST, n, MaxEntry)
+// Returns nil if it's not there.
+func Locate(n string) *symtab.Entry {
+	e, _ := ST.Lookup(n)
+	return e
 }
 
 // InTable Looks for Symbol in Table
 func InTable(n string) bool {
-	// Original code calls Lookup, but I'm using Locate as otherwise it has
-	// no use
-	return Locate(n) != -1
+	return Locate(n) != nil
 }
 
 // CheckTable Checks to See if an Identifier is in the Symbol Table
@@ -196,13 +189,10 @@ func CheckDup(n string) {
 
 // AddEntry Adds a New Entry to Symbol Table
 func AddEntry(n string, t rune) {
-	CheckDup(n)
-	if NEntry == MaxEntry {
-		Abort("Symbol Table Full")
+	_, err := ST.Add(symtab.Entry{Name: n, Kind: symtab.Kind(t)})
+	if err != nil {
+		Duplicate(n)
 	}
-	NEntry++
-	ST[NEntry] = n
-	SType[NEntry] = t
 }
 
 // GetName Gets an Identifier
@@ -222,15 +212,15 @@ func GetName() {
 // GetNum Gets a Number
 func GetNum() {
 	SkipWhite()
-	if !IsDigit(Look) {
+	if !number.IsStart(Look) {
 		Expected("Integer")
 	}
 	Token = '#'
-	Value = ""
-	for IsDigit(Look) {
-		Value += string(Look)
-		GetChar()
+	val, err := number.Scan(func() rune { return Look }, GetChar, number.Word)
+	if err != nil {
+		Abort(err.Error())
 	}
+	Value = strconv.FormatInt(val, 10)
 }
 
 // GetOp Gets an Operator
@@ -246,7 +236,7 @@ func Next() {
 	SkipWhite()
 	if IsAlpha(Look) {
 		GetName()
-	} else if IsDigit(Look) {
+	} else if number.IsStart(Look) {
 		GetNum()
 	} else {
 		GetOp()
@@ -780,8 +770,7 @@ func TopDecls() {
 
 // Init Initializes
 func Init() {
-	ST = make([]string, MaxEntry)
-	SType = make([]rune, MaxEntry)
+	ST = symtab.New()
 	GetChar()
 	Next()
 }
@@ -1,10 +1,29 @@
 //Note: This code covers the C style and semicolon and comment parsing in this
 //chapter. The code here matches the following style:
+//Rules (1) to (5) are those of the default Dialect, CDialect. Set Lang to
+//BraceDialect for the rules of chapter 12, or to PascalDialect.
 //(1) Semicolons are TERMINATORS, not seperators
 //(2) Semicolons are NOT OPTIONAL
 //(3) Comments are delimited by /* and */
 //(4) /* */ Comments can be nested
 //(5) //one sides style comments are also supported
+//(6) Two character operators (<= >= <> != == := && || << >>) are scanned as
+//    single tokens, so C and Pascal spellings can both be used
+//(7) String literals are written in double quotes, with \n \t \r \0 \" and
+//    \\ escapes, and may be written out with WRITE
+//(8) Numbers may be written in hex ($FF or 0xFF), binary (%1010 or 0b1010),
+//    octal (0o17) or as a character ('A'), and must fit in a word
+//(9) Identifiers are folded to upper case unless the dialect is
+//    CaseSensitive, and keywords may be any case unless it is
+//    KeywordCaseSensitive
+//(10) An error abandons only the statement or declaration it is found in, so
+//    one compile reports every error in the program. A missing semicolon
+//    before a statement or the end of a block is reported and then assumed
+//(11) Variables may be declared as one-dimensional arrays, VAR a[100], whose
+//    elements a[0] to a[99] are indexed by any expression
+//(12) Procedures may be declared among the globals, with value parameters and
+//    local variables addressed off A6:
+//    PROCEDURE name(a, b); VAR x; BEGIN ... END;
 
 //Sample test (ignore single line comments at start; there is a nested /* */)
 //program
@@ -18,6 +37,18 @@
 //c=5;
 //end.
 
+//Sample CASE test
+//program
+//var a,b;
+//begin
+//case a of
+//1, 3: b=1;
+//4..6: b=2; a=0;
+//7: b=3;
+//otherwise b=0;
+//endcase;
+//end.
+
 package tiny
 
 import (
@@ -25,14 +56,23 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/dcw303/crenshaw-go/cfg"
+	"github.com/dcw303/crenshaw-go/number"
+	"github.com/dcw303/crenshaw-go/symtab"
 	"github.com/dcw303/crenshaw-go/util"
 )
 
 // LCount is a Label Counter
 var LCount int
 
-// NEntry is the Next Entry in the Symbol Table
-var NEntry int
+// BoundsCheck Turns On Runtime Checking of Array Indexes
+// An index out of range calls BOUNDS in the runtime with the source line in
+// D1.
+var BoundsCheck bool
+
+// CFGFile Names a Graphviz DOT File to Receive the Control Flow Graph
+// The graph is only built when this is set.
+var CFGFile string
 
 // Look is a Lookahead character
 var Look rune
@@ -40,39 +80,173 @@ var Look rune
 // Token is an Encoded Token
 var Token rune
 
+// TokenCode is the Type of an Encoded Token, for Printing
+type TokenCode rune
+
+// String Names an Encoded Token
+func (c TokenCode) String() string {
+	switch c {
+	case 'x':
+		return "Ident"
+	case '#':
+		return "Number"
+	case '"':
+		return "String"
+	case 'i':
+		return "If"
+	case 'l':
+		return "Else"
+	case 'e':
+		return "End"
+	case 'w':
+		return "While"
+	case 'R':
+		return "Read"
+	case 'W':
+		return "Write"
+	case 'v':
+		return "Var"
+	case 'c':
+		return "Case"
+	case 'o':
+		return "Otherwise"
+	case 'p':
+		return "Procedure"
+	}
+	return "Operator"
+}
+
+// Pos is a Position in the Source
+type Pos struct {
+	Line int
+	Col  int
+}
+
+// String Formats a Position as line:col
+func (p Pos) String() string {
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Col)
+}
+
+// LookPos is the Position of the Lookahead Character
+var LookPos Pos
+
+// TokenPos is the Position Where the Current Token Started
+var TokenPos Pos
+
+// readPos is the position of the last character read from the input
+var readPos = Pos{1, 0}
+
+// tempPos is the position of TempChar
+var tempPos Pos
+
 // Value is an Unencoded Token
 var Value string
 
-// MaxEntry is the number of Entries allowed in the Symbol Table
-const MaxEntry = 100
+// TokenCount is the Number of Tokens Read So Far
+var TokenCount int
 
-// TempChar is a Temporary Character
-var TempChar = ' '
+// Diagnostic is an Error Found During Compilation
+type Diagnostic struct {
+	Pos Pos
+	Msg string
+}
 
-// ST is the Symbol Table
-var ST []string
+// String Formats a Diagnostic as line:col: message
+func (d Diagnostic) String() string {
+	return d.Pos.String() + ": " + d.Msg
+}
+
+// Diagnostics Lists the Errors Reported So Far
+var Diagnostics []Diagnostic
+
+// lastError is the value of TokenCount at the last error
+// A second error on the same token is a cascade of the first and is dropped.
+var lastError int
+
+// Nesting is the Number of Structured Statements Whose End is Still to Come
+var Nesting int
+
+// Spelling is the Current Name Exactly as it was Written
+var Spelling string
+
+// Strings is the Pool of String Literals, Emitted After the Code
+var Strings []string
+
+// MinJumpTable is the Fewest Case Labels Worth a Jump Table
+const MinJumpTable = 4
+
+// MaxJumpTable is the Largest Span of Values Allowed in a Jump Table
+const MaxJumpTable = 256
+
+// MaxArraySize is the Most Elements an Array May Have
+// Elements are word sized and indexed through a signed word register, so the
+// byte offset of the last one must fit in 16 bits.
+const MaxArraySize = 16384
+
+// CaseLabel is a Constant or Range Selecting an Arm of a CASE
+type CaseLabel struct {
+	Low    int
+	High   int
+	Target string
+}
 
-// SType is the Symbol Type Table
-var SType []rune
+// TempChar is a Temporary Character, or 0 When Empty
+var TempChar rune
+
+// ST is the Symbol Table
+var ST *symtab.Table
 
 // Definition of Keywords and Token Types
 
 // NKW is the Number of Keywords
-const NKW = 9
+const NKW = 13
 
 // NKW1 is the Number of Keywords + 1 (?)
-const NKW1 = 10
+const NKW1 = 14
 
 // KWList is the Keyword List
 var KWList = []string{"IF", "ELSE", "ENDIF", "WHILE", "ENDWHILE", "READ",
-	"WRITE", "VAR", "END"}
+	"WRITE", "VAR", "END", "CASE", "OTHERWISE", "ENDCASE", "PROCEDURE"}
 
 // KWCode is the Keyword Code
-const KWCode string = "xileweRWve"
+const KWCode string = "xileweRWvecoep"
+
+// Codes for Multi-Character Operators
+const (
+	OpLE     = '≤'
+	OpGE     = '≥'
+	OpNE     = '≠'
+	OpEQ     = '≡'
+	OpAssign = '←'
+	OpAnd    = '∧'
+	OpOr     = '∨'
+	OpShl    = '«'
+	OpShr    = '»'
+)
+
+// OpList is the Multi-Character Operator List
+var OpList = []string{"<=", ">=", "<>", "!=", "==", ":=", "&&", "||", "<<",
+	">>"}
+
+// OpCode is the Multi-Character Operator Code
+var OpCode = []rune{OpLE, OpGE, OpNE, OpNE, OpEQ, OpAssign, OpAnd, OpOr,
+	OpShl, OpShr}
+
+// ReadChar Reads a Character From Input Stream, Tracking its Position
+func ReadChar() (r rune) {
+	r = util.Read()
+	readPos.Col++
+	if r == 0x0D {
+		readPos.Line++
+		readPos.Col = 0
+	}
+	return
+}
 
 // GetCharX Reads New Character From Input Stream
 func GetCharX() {
-	Look = util.Read()
+	Look = ReadChar()
+	LookPos = readPos
 }
 
 // Error Reports an Error
@@ -81,19 +255,135 @@ func Error(s string) {
 	util.WriteLine("Error: " + s)
 }
 
-// Abort Reports Error and Halts
+// Abort Records an Error and Abandons the Current Statement
+// The panic is caught by Recover, which skips ahead to where parsing can carry
+// on.
 func Abort(s string) {
-	Error(s)
+	AbortAt(TokenPos, s)
+}
+
+// AbortAt Records an Error Found at a Given Position and Abandons the
+// Current Statement
+func AbortAt(pos Pos, s string) {
+	ReportAt(pos, s)
 	panic("Aborted")
 }
 
+// Report Records an Error Without Abandoning the Statement
+// Only the first error on a token is kept.
+func Report(s string) {
+	ReportAt(TokenPos, s)
+}
+
+// ReportAt Records an Error Found at a Given Position
+// The error still counts as one on the current token.
+func ReportAt(pos Pos, s string) {
+	if TokenCount != lastError {
+		d := Diagnostic{pos, s}
+		Diagnostics = append(Diagnostics, d)
+		Error(d.String())
+	}
+	lastError = TokenCount
+}
+
+// Recover Catches an Error and Resynchronizes the Parser
+// It must be deferred.
+func Recover() {
+	if r := recover(); r != nil {
+		if r != "Aborted" {
+			panic(r)
+		}
+		Synchronize()
+	}
+}
+
+// RecoverStatement Catches an Error in a Statement and Resynchronizes
+// It must be deferred, with the nesting and token count the statement began
+// at. Structured statements the error left open are skipped up to their own
+// end keywords, so those cannot close an enclosing block instead. A statement
+// that failed on its first token has that token skipped, so it cannot fail
+// there again.
+func RecoverStatement(depth int, count int) {
+	if r := recover(); r != nil {
+		if r != "Aborted" {
+			panic(r)
+		}
+		open := Nesting - depth
+		Nesting = depth
+		if TokenCount == count {
+			Next()
+		}
+		SkipStructures(open)
+		Synchronize()
+	}
+}
+
+// SkipStructures Skips to the End of n Open Structured Statements
+// Structures nested in them are skipped whole. It stops early before the END
+// of a block, or at the end of the input.
+func SkipStructures(n int) {
+	for n > 0 {
+		Scan()
+		switch {
+		case Token == 0x1A || IsBlockEnd():
+			return
+		case Token == 'i' || Token == 'w' || Token == 'c':
+			n++
+		case Token == 'e':
+			n--
+		}
+		Next()
+	}
+}
+
+// IsBlockEnd Recognizes the END of a Block
+// In a dialect that closes structured statements with END as well, it is
+// taken as the end of the statement.
+func IsBlockEnd() bool {
+	return Token == 'e' && IsKeyword("END") && !IsKeyword("ENDIF") &&
+		!IsKeyword("ENDWHILE") && !IsKeyword("ENDCASE")
+}
+
+// Synchronize Skips Tokens Until Parsing Can Resume
+// It stops after a semicolon, or before a keyword that ends a block or begins
+// a statement. The token the error was found on is skipped, as parsing has
+// already failed there once, unless parsing could resume before it.
+func Synchronize() {
+	Scan()
+	if TokenCount == lastError && Token != ';' && !IsResumePoint() {
+		Next()
+	}
+	for {
+		Scan()
+		if Token == ';' {
+			Next()
+			return
+		}
+		if IsResumePoint() {
+			return
+		}
+		Next()
+	}
+}
+
+// IsResumePoint Recognizes a Token Parsing Can Resume Before
+func IsResumePoint() bool {
+	switch Token {
+	case 'e', 'l', 'o', 'i', 'w', 'c', 'R', 'W', 'v', 'p', 0x1A:
+		return true
+	}
+	return Token == 'x' && IsKeyword("BEGIN")
+}
+
 // Expected Reports What Was Expected
 func Expected(s string) {
 	Abort(s + " Expected")
 }
 
 // Undefined Reports an Undefined Identifier
+// The name is then entered as a variable so it is only reported once.
 func Undefined(n string) {
+	AddEntry(n, 'v')
 	Abort("Undefined Identifier " + n)
 }
 
@@ -136,27 +426,37 @@ func IsMulOp(r rune) bool {
 
 // IsOrOp Recognizes a Boolean OrOp
 func IsOrOp(r rune) bool {
-	return strings.ContainsRune("|~", r)
+	return strings.ContainsRune("|~", r) || r == OpOr
+}
+
+// IsAndOp Recognizes a Boolean AndOp
+func IsAndOp(r rune) bool {
+	return r == '&' || r == OpAnd
 }
 
 // IsRelOp Recognizes a RelOp
 func IsRelOp(r rune) bool {
-	return strings.ContainsRune("=#<>", r)
+	return strings.ContainsRune("=<>", r) || r == OpLE || r == OpGE ||
+		r == OpNE || r == OpEQ
+}
+
+// IsShiftOp Recognizes a Shift Operator
+func IsShiftOp(r rune) bool {
+	return r == OpShl || r == OpShr
 }
 
 // IsWhite Recognizes White Space
 func IsWhite(r rune) bool {
-	// SPACE / TAB / CR / LF / comments marker / one sided comment marker
-	return r == 0x20 || r == 0x09 || r == 0x0D || r == 0xFF || r == 0xFE
+	// SPACE / TAB / CR / LF / comment marks
+	return r == 0x20 || r == 0x09 || r == 0x0D || IsCommentMark(r)
 }
 
 // SkipWhite Skips Over Leading White Space
 func SkipWhite() {
 	for IsWhite(Look) {
-		if Look == 0xFF {
-			SkipComment()
-		} else if Look == 0xFE {
-			SkipOneSidedComment()
+		if IsCommentMark(Look) {
+			SkipComment(Lang.Comments[Look-CommentMark])
+			Intercept()
 		} else {
 			GetChar()
 		}
@@ -180,13 +480,15 @@ func Lookup(table []string, s string, n int) int {
 }
 
 // Locate Locates a Symbol in Table
-func Locate(n string) int {
-	return Lookup(ST, n, MaxEntry)
+// Returns nil if it's not there.
+func Locate(n string) *symtab.Entry {
+	e, _ := ST.Lookup(n)
+	return e
 }
 
 // InTable Looks for Symbol in Table
 func InTable(n string) bool {
-	return Locate(n) != -1
+	return Locate(n) != nil
 }
 
 // CheckTable Checks to See if an Identifier is in the Symbol Table
@@ -207,13 +509,10 @@ func CheckDup(n string) {
 
 // AddEntry Adds a New Entry to Symbol Table
 func AddEntry(n string, t rune) {
-	CheckDup(n)
-	if NEntry == MaxEntry {
-		Abort("Symbol Table Full")
+	_, err := ST.Add(symtab.Entry{Name: n, Kind: symtab.Kind(t), Line: TokenPos.Line, Col: TokenPos.Col})
+	if err != nil {
+		Duplicate(n)
 	}
-	NEntry++
-	ST[NEntry] = n
-	SType[NEntry] = t
 }
 
 // GetName Gets an Identifier
@@ -223,42 +522,116 @@ func GetName() {
 		Expected("Name")
 	}
 	Token = 'x'
-	Value = ""
+	Spelling = ""
 	for IsAlNum(Look) {
-		Value += string(unicode.ToUpper(Look))
+		Spelling += string(Look)
 		GetChar()
 	}
+	Value = Spelling
+	if !Lang.CaseSensitive {
+		Value = strings.ToUpper(Spelling)
+	}
+}
+
+// IsKeyword Checks Whether the Current Name Spells a Given Keyword
+func IsKeyword(kw string) bool {
+	if Lang.KeywordCaseSensitive {
+		return Spelling == Spell(kw)
+	}
+	return strings.ToUpper(Spelling) == Spell(kw)
+}
+
+// KeywordIndex Looks Up the Current Name in the Keyword Table
+func KeywordIndex() int {
+	i := NKW - 1
+	for i >= 0 && !IsKeyword(KWList[i]) {
+		i--
+	}
+	return i
 }
 
 // GetNum Gets a Number
 func GetNum() {
 	SkipWhite()
-	if !IsDigit(Look) {
+	if !number.IsStart(Look) {
 		Expected("Integer")
 	}
 	Token = '#'
+	val, err := number.Scan(func() rune { return Look }, GetChar, number.Word)
+	if err != nil {
+		Abort(err.Error())
+	}
+	Value = strconv.FormatInt(val, 10)
+}
+
+// GetString Gets a String Literal
+// The quotes are dropped and escape sequences are decoded into Value.
+func GetString() {
+	SkipWhite()
+	Token = '"'
 	Value = ""
-	for IsDigit(Look) {
-		Value += string(Look)
+	GetChar()
+	for Look != '"' {
+		switch Look {
+		case 0x0D, 0x1A:
+			Abort("Unterminated String")
+		case '\\':
+			GetChar()
+			switch Look {
+			case 'n':
+				Value += "\n"
+			case 't':
+				Value += "\t"
+			case 'r':
+				Value += "\r"
+			case '0':
+				Value += "\x00"
+			case '"', '\\':
+				Value += string(Look)
+			default:
+				Abort("Invalid Escape \\" + string(Look))
+			}
+		default:
+			if IsCommentMark(Look) {
+				Value += Lang.Comments[Look-CommentMark].Open
+			} else {
+				Value += string(Look)
+			}
+		}
 		GetChar()
 	}
+	GetChar()
 }
 
 // GetOp Gets an Operator
+// Two character operators are looked up in OpList and returned as a single
+// token. A lone # is the old spelling of not equal.
 func GetOp() {
 	SkipWhite()
 	Token = Look
 	Value = string(Look)
 	GetChar()
+	if k := Lookup(OpList, Value+string(Look), len(OpList)); k != -1 {
+		Token = OpCode[k]
+		Value = OpList[k]
+		GetChar()
+	} else if Token == '#' {
+		Token = OpNE
+	}
 }
 
 // Next Gets the Next Input Token
 func Next() {
 	SkipWhite()
+	TokenPos = LookPos
+	TokenCount++
+	Spelling = ""
 	if IsAlpha(Look) {
 		GetName()
-	} else if IsDigit(Look) {
+	} else if number.IsStart(Look) {
 		GetNum()
+	} else if Look == '"' {
+		GetString()
 	} else {
 		GetOp()
 	}
@@ -267,13 +640,18 @@ func Next() {
 // Scan Gets an Identifier and Scans it for Keywords
 func Scan() {
 	if Token == 'x' {
-		Token = rune(KWCode[Lookup(KWList, Value, NKW)+1])
+		Token = rune(KWCode[KeywordIndex()+1])
 	}
 }
 
 // MatchString Matches a Specific Input String
+// Keywords are matched against the name as it was spelled.
 func MatchString(x string) {
-	if Value != x {
+	if IsAlpha(rune(x[0])) && Spelling != "" {
+		if !IsKeyword(x) {
+			Expected(x)
+		}
+	} else if Value != x {
 		Expected(x)
 	}
 	Next()
@@ -325,10 +703,36 @@ func LoadConst(n string) {
 
 // LoadVar Loads a Variable to Primary Register
 func LoadVar(name string) {
-	if !InTable(name) {
+	EmitLn("MOVE " + Address(name) + ",D0")
+}
+
+// Address Returns the Address of a Variable
+// Globals are addressed relative to the PC, and the parameters and locals of
+// a procedure relative to its frame pointer, A6.
+func Address(name string) string {
+	e := Locate(name)
+	if e == nil {
 		Undefined(name)
 	}
-	EmitLn("MOVE " + name + "(PC),D0")
+	if e.Kind == symtab.Proc {
+		Abort(name + " is not a Variable")
+	}
+	if IsLocal(name) {
+		return strconv.Itoa(e.Offset) + "(A6)"
+	}
+	return name + "(PC)"
+}
+
+// IsLocal Checks Whether a Name is a Parameter or Local of a Procedure
+func IsLocal(name string) bool {
+	e := Locate(name)
+	return e != nil && e.Level > 0
+}
+
+// IsProc Checks Whether a Name is a Procedure
+func IsProc(name string) bool {
+	e := Locate(name)
+	return e != nil && e.Kind == symtab.Proc
 }
 
 // Push Pushes Primary onto Stack
@@ -375,11 +779,43 @@ func PopXor() {
 	EmitLn("EOR (SP)+,D0")
 }
 
+// PopShl Shifts Top of Stack Left by Primary
+func PopShl() {
+	EmitLn("MOVE D0,D1")
+	EmitLn("MOVE (SP)+,D0")
+	EmitLn("ASL D1,D0")
+}
+
+// PopShr Shifts Top of Stack Right by Primary
+func PopShr() {
+	EmitLn("MOVE D0,D1")
+	EmitLn("MOVE (SP)+,D0")
+	EmitLn("ASR D1,D0")
+}
+
 // PopCompare Compares Top of Stack with Primary
 func PopCompare() {
 	EmitLn("CMP (SP)+,D0")
 }
 
+// SetCondition Sets D0 if a Comparison Holds
+func SetCondition(cc string) {
+	switch cc {
+	case "EQ":
+		SetEqual()
+	case "NE":
+		SetNEqual()
+	case "LT":
+		SetGreater()
+	case "GT":
+		SetLess()
+	case "GE":
+		SetLessOrEqual()
+	case "LE":
+		SetGreaterOrEqual()
+	}
+}
+
 // SetEqual Sets D0 if Compare was =
 func SetEqual() {
 	EmitLn("SEQ D0")
@@ -418,10 +854,68 @@ func SetGreaterOrEqual() {
 
 // Store Stores Primary to Variable
 func Store(name string) {
+	a := Address(name)
+	if IsLocal(name) {
+		EmitLn("MOVE D0," + a)
+		return
+	}
 	EmitLn("LEA " + name + "(PC),A0")
 	EmitLn("MOVE D0,(A0)")
 }
 
+// ProcProlog Writes the Prolog for a Procedure
+// Space is made on the stack for k words of locals.
+func ProcProlog(name string, k int) {
+	PostLabel(name)
+	EmitLn("LINK A6,#" + strconv.Itoa(-2*k))
+}
+
+// ProcEpilog Writes the Epilog for a Procedure
+func ProcEpilog() {
+	EmitLn("UNLK A6")
+	EmitLn("RTS")
+}
+
+// Call Calls a Procedure
+func Call(name string) {
+	EmitLn("BSR " + name)
+}
+
+// CleanStack Adjusts the Stack Pointer Upwards by n Bytes
+func CleanStack(n int) {
+	if n > 0 {
+		EmitLn("ADD #" + strconv.Itoa(n) + ",SP")
+	}
+}
+
+// LoadElement Loads an Array Element to Primary Register
+// The index is in the primary register.
+func LoadElement(name string) {
+	EmitLn("ADD D0,D0")
+	EmitLn("LEA " + name + "(PC),A0")
+	EmitLn("MOVE 0(A0,D0.W),D0")
+}
+
+// StoreElement Stores Primary to an Array Element
+// The index is on the stack.
+func StoreElement(name string) {
+	EmitLn("MOVE (SP)+,D1")
+	EmitLn("ADD D1,D1")
+	EmitLn("LEA " + name + "(PC),A0")
+	EmitLn("MOVE D0,0(A0,D1.W)")
+}
+
+// CheckBounds Checks the Index in the Primary Register Against an Array Size
+// The comparison is unsigned, so a negative index is caught too.
+func CheckBounds(size int) {
+	l := NewLabel()
+	EmitLn("CMP #" + strconv.Itoa(size) + ",D0")
+	EmitLn("BLO " + l)
+	EmitLn("MOVE #" + strconv.Itoa(TokenPos.Line) + ",D1")
+	EmitLn("BSR BOUNDS")
+	PostLabel(l)
+}
+
 // Branch Branches Unconditional
 func Branch(l string) {
 	EmitLn("BRA " + l)
@@ -433,17 +927,43 @@ func BranchFalse(l string) {
 	EmitLn("BEQ " + l)
 }
 
+// BranchUnless Branches if a Comparison Does Not Hold
+func BranchUnless(cc string, l string) {
+	inverse := map[string]string{"EQ": "NE", "NE": "EQ", "LT": "GE", "GE": "LT",
+		"GT": "LE", "LE": "GT"}
+	EmitLn("B" + inverse[cc] + " " + l)
+}
+
+// BranchTrue Branches true
+func BranchTrue(l string) {
+	EmitLn("TST D0")
+	EmitLn("BNE " + l)
+}
+
 // ReadIt Reads Variable to Primary Register
 func ReadIt(name string) {
 	EmitLn("BSR READ")
 	Store(name)
 }
 
+// ReadElement Reads an Array Element
+// The index is on the stack.
+func ReadElement(name string) {
+	EmitLn("BSR READ")
+	StoreElement(name)
+}
+
 // WriteIt Writes from Primary Register
 func WriteIt() {
 	EmitLn("BSR WRITE")
 }
 
+// WriteStr Writes the String Literal Whose Address is in A0
+func WriteStr(l string) {
+	EmitLn("LEA " + l + "(PC),A0")
+	EmitLn("BSR WRITESTR")
+}
+
 // Header Writes Header Info
 func Header() {
 	util.WriteLine("WARMST\t'EQU $A01E'")
@@ -457,20 +977,81 @@ func Prolog() {
 // Epilog Writes the Epilog
 func Epilog() {
 	util.WriteLine("DC WARMST")
+	DumpStrings()
 	util.WriteLine("END MAIN")
 }
 
+// AddString Adds a Literal to the String Pool, Returning its Label
+func AddString(str string) string {
+	i := 0
+	for i < len(Strings) && Strings[i] != str {
+		i++
+	}
+	if i == len(Strings) {
+		Strings = append(Strings, str)
+	}
+	return "S" + strconv.Itoa(i)
+}
+
+// StringConst Formats a String as Null Terminated DC.B Operands
+// Printable characters are quoted and anything else is written as a byte.
+func StringConst(str string) (out string) {
+	quoted := false
+	for _, b := range []byte(str) {
+		if b >= 0x20 && b < 0x7F {
+			if !quoted {
+				out += "'"
+				quoted = true
+			}
+			if b == '\'' {
+				out += "'"
+			}
+			out += string(rune(b))
+			continue
+		}
+		if quoted {
+			out += "',"
+			quoted = false
+		}
+		out += strconv.Itoa(int(b)) + ","
+	}
+	if quoted {
+		out += "',"
+	}
+	return out + "0"
+}
+
+// DumpStrings Allocates Storage for the String Pool
+func DumpStrings() {
+	for i, str := range Strings {
+		util.WriteLine("S" + strconv.Itoa(i) + ":\tDC.B " + StringConst(str))
+	}
+	if len(Strings) > 0 {
+		util.WriteLine("EVEN")
+	}
+}
+
 // Allocate Allocates Storage for a Static Variable
 func Allocate(name string, val string) {
 	util.WriteLine(name + ":\tDC " + val)
 }
 
+// AllocateArray Allocates Storage for an Array
+func AllocateArray(name string, size int) {
+	util.WriteLine(name + ":\tDS.W " + strconv.Itoa(size))
+}
+
 // Factor Parses and Translates a Math Factor
 func Factor() {
 	if Token == '(' {
 		Next()
 		BoolExpression()
 		MatchString(")")
+	} else if Token == 'x' && IsArray(Value) {
+		name := Value
+		Next()
+		Index(name)
+		LoadElement(name)
 	} else {
 		if Token == 'x' {
 			LoadVar(Value)
@@ -543,9 +1124,37 @@ func Expression() {
 	}
 }
 
+// ShiftLeft Recognizes and Translates a Left Shift
+func ShiftLeft() {
+	Next()
+	Expression()
+	PopShl()
+}
+
+// ShiftRight Recognizes and Translates a Right Shift
+func ShiftRight() {
+	Next()
+	Expression()
+	PopShr()
+}
+
+// ShiftExpression Parses and Translates a Shift Expression
+func ShiftExpression() {
+	Expression()
+	for IsShiftOp(Token) {
+		Push()
+		switch Token {
+		case OpShl:
+			ShiftLeft()
+		case OpShr:
+			ShiftRight()
+		}
+	}
+}
+
 // CompareExpression Gets Another Expression and Compares
 func CompareExpression() {
-	Expression()
+	ShiftExpression()
 	PopCompare()
 }
 
@@ -556,63 +1165,95 @@ func NextExpression() {
 }
 
 // Equals Recognizes and Translates a Relational "Equals"
-func Equals() {
+func Equals() string {
 	NextExpression()
-	SetEqual()
+	return "EQ"
 }
 
 // LessOrEqual Recognizes and Translates a Relational "Less Than or Equal"
-func LessOrEqual() {
+func LessOrEqual() string {
 	NextExpression()
-	SetLessOrEqual()
+	return "GE"
 }
 
 // NotEqual Recognizes and Translates a Relational "Not Equals"
-func NotEqual() {
+func NotEqual() string {
 	NextExpression()
-	SetNEqual()
+	return "NE"
 }
 
 // Less Recognizes and Translates a Relational "Less Than"
-func Less() {
-	Next()
-	switch Token {
-	case '=':
-		LessOrEqual()
-	case '>':
-		NotEqual()
-	default:
-		CompareExpression()
-		SetLess()
-	}
+func Less() string {
+	NextExpression()
+	return "GT"
 }
 
 // Greater Recognizes and Translates a Relational "Greater Than"
-func Greater() {
-	Next()
-	if Token == '=' {
-		NextExpression()
-		SetGreaterOrEqual()
-	} else {
-		CompareExpression()
-		SetGreater()
-	}
+func Greater() string {
+	NextExpression()
+	return "LT"
 }
 
-// Relation Parses and  Translates a Relation
-func Relation() {
-	Expression()
+// GreaterOrEqual Recognizes and Translates a Relational "Greater Than or
+// Equal"
+func GreaterOrEqual() string {
+	NextExpression()
+	return "LE"
+}
+
+// Compare Parses an Expression and Compares it with the Next, if Any
+// The condition code that holds when the relation is true is returned, with
+// the comparison left in the flags. It is empty if there was no relation.
+// Note that PopCompare subtracts the left side from the right, so the codes
+// read backwards: a ">" relation holds on LT.
+func Compare() (cc string) {
+	ShiftExpression()
 	if IsRelOp(Token) {
 		Push()
 		switch Token {
-		case '=':
-			Equals()
+		case '=', OpEQ:
+			cc = Equals()
+		case OpNE:
+			cc = NotEqual()
 		case '<':
-			Less()
+			cc = Less()
+		case OpLE:
+			cc = LessOrEqual()
 		case '>':
-			Greater()
+			cc = Greater()
+		case OpGE:
+			cc = GreaterOrEqual()
 		}
 	}
+	return
+}
+
+// Relation Parses and  Translates a Relation
+func Relation() {
+	if cc := Compare(); cc != "" {
+		SetCondition(cc)
+	}
+}
+
+// Condition Parses and Translates the Condition of an IF or WHILE
+// A lone relation is compiled to a compare and a single branch to l. Anything
+// more complex falls back to materializing the boolean and testing it.
+func Condition(l string) {
+	if Token != '!' {
+		cc := Compare()
+		if cc != "" && !IsAndOp(Token) && !IsOrOp(Token) {
+			BranchUnless(cc, l)
+			return
+		}
+		if cc != "" {
+			SetCondition(cc)
+		}
+		BoolTermTail()
+		BoolExpressionTail()
+	} else {
+		BoolExpression()
+	}
+	BranchFalse(l)
 }
 
 // NotFactor Parses and Translates a Boolean Factor with Leading NOT
@@ -629,14 +1270,32 @@ func NotFactor() {
 // BoolTerm Parses and Translates a Boolean Term
 func BoolTerm() {
 	NotFactor()
-	for Look == '&' {
+	BoolTermTail()
+}
+
+// BoolTermTail Translates the Rest of a Boolean Term After its First Factor
+func BoolTermTail() {
+	for IsAndOp(Token) {
+		if Lang.ShortCircuit {
+			AndThen()
+			continue
+		}
 		Push()
 		Next()
 		NotFactor()
-		PopAdd()
+		PopAnd()
 	}
 }
 
+// AndThen Recognizes and Translates a Short-Circuit AND
+func AndThen() {
+	Next()
+	l := NewLabel()
+	BranchFalse(l)
+	NotFactor()
+	PostLabel(l)
+}
+
 // BoolOr Recognizes and Translates a Boolean OR
 func BoolOr() {
 	Next()
@@ -644,6 +1303,15 @@ func BoolOr() {
 	PopOr()
 }
 
+// OrElse Recognizes and Translates a Short-Circuit OR
+func OrElse() {
+	Next()
+	l := NewLabel()
+	BranchTrue(l)
+	BoolTerm()
+	PostLabel(l)
+}
+
 // BoolXor Recognizes and Translates an Exclusive OR
 func BoolXor() {
 	Next()
@@ -654,10 +1322,20 @@ func BoolXor() {
 // BoolExpression Parses and Translates a Boolean Expression
 func BoolExpression() {
 	BoolTerm()
+	BoolExpressionTail()
+}
+
+// BoolExpressionTail Translates the Rest of a Boolean Expression After its
+// First Term
+func BoolExpressionTail() {
 	for IsOrOp(Token) {
+		if Lang.ShortCircuit && Token != '~' {
+			OrElse()
+			continue
+		}
 		Push()
 		switch Token {
-		case '|':
+		case '|', OpOr:
 			BoolOr()
 		case '~':
 			BoolXor()
@@ -667,21 +1345,50 @@ func BoolExpression() {
 
 // Assignment Parses and Translates an Assignment Statement
 func Assignment() {
+	CheckIdent()
 	CheckTable(Value)
 	name := Value
 	Next()
-	MatchString("=")
+	if IsArray(name) {
+		Index(name)
+		Push()
+	}
+	if Token != '=' && Token != OpAssign {
+		Expected("=")
+	}
+	Next()
 	BoolExpression()
-	Store(name)
+	if IsArray(name) {
+		StoreElement(name)
+	} else {
+		Store(name)
+	}
+}
+
+// IsArray Checks Whether a Name is an Array
+func IsArray(name string) bool {
+	e := Locate(name)
+	return e != nil && e.Size > 0
+}
+
+// Index Parses and Translates an Array Index, Leaving it in the Primary
+// Register
+func Index(name string) {
+	MatchString("[")
+	BoolExpression()
+	if BoundsCheck {
+		CheckBounds(Locate(name).Size)
+	}
+	MatchString("]")
 }
 
 // DoIf Recognizes and Translates an IF Construct
 func DoIf() {
 	Next()
-	BoolExpression()
+	Nesting++
 	l1 := NewLabel()
 	l2 := l1
-	BranchFalse(l1)
+	Condition(l1)
 	Block()
 	if Token == 'l' {
 		Next()
@@ -692,28 +1399,203 @@ func DoIf() {
 	}
 	PostLabel(l2)
 	MatchString("ENDIF")
+	Nesting--
 }
 
 // DoWhile Parses and Translates a WHILE Statement
 func DoWhile() {
 	Next()
+	Nesting++
 	l1 := NewLabel()
 	l2 := NewLabel()
 	PostLabel(l1)
-	BoolExpression()
-	BranchFalse(l2)
+	Condition(l2)
 	Block()
 	MatchString("ENDWHILE")
+	Nesting--
 	Branch(l1)
 	PostLabel(l2)
 }
 
+// CaseConst Gets a Constant Case Label
+func CaseConst() int {
+	neg := false
+	if Token == '-' {
+		neg = true
+		Next()
+	}
+	if Token != '#' {
+		Expected("Case Label")
+	}
+	n, err := strconv.Atoi(Value)
+	if err != nil {
+		Abort("Invalid Case Label " + Value)
+	}
+	Next()
+	if neg {
+		m, err := number.Negate(int64(n), number.Word)
+		if err != nil {
+			Abort(err.Error())
+		}
+		n = int(m)
+	}
+	return n
+}
+
+// CaseLabelList Parses the Labels of a CASE Arm
+func CaseLabelList(target string, labels []CaseLabel) []CaseLabel {
+	for {
+		low := CaseConst()
+		high := low
+		if Token == '.' {
+			Next()
+			MatchString(".")
+			high = CaseConst()
+		}
+		if high < low {
+			Abort("Empty Case Range")
+		}
+		for _, c := range labels {
+			if low <= c.High && high >= c.Low {
+				Abort("Duplicate Case Label")
+			}
+		}
+		labels = append(labels, CaseLabel{low, high, target})
+		if Token != ',' {
+			return labels
+		}
+		Next()
+	}
+}
+
+// IsCaseLabel Recognizes the Start of a Case Label
+func IsCaseLabel(t rune) bool {
+	return t == '#' || t == '-'
+}
+
+// IsDense Decides Whether Case Labels Suit a Jump Table
+func IsDense(labels []CaseLabel) bool {
+	if len(labels) < MinJumpTable {
+		return false
+	}
+	low, high := labels[0].Low, labels[0].High
+	count := 0
+	for _, c := range labels {
+		if c.Low < low {
+			low = c.Low
+		}
+		if c.High > high {
+			high = c.High
+		}
+		count += c.High - c.Low + 1
+	}
+	span := high - low + 1
+	return span <= MaxJumpTable && 2*count >= span
+}
+
+// JumpTable Dispatches on D0 Through an Indexed Table of Offsets
+func JumpTable(labels []CaseLabel, other string) {
+	low, high := labels[0].Low, labels[0].High
+	for _, c := range labels {
+		if c.Low < low {
+			low = c.Low
+		}
+		if c.High > high {
+			high = c.High
+		}
+	}
+	if low != 0 {
+		EmitLn("SUB #" + strconv.Itoa(low) + ",D0")
+	}
+	EmitLn("CMP #" + strconv.Itoa(high-low) + ",D0")
+	EmitLn("BHI " + other)
+	EmitLn("ADD D0,D0")
+	t := NewLabel()
+	EmitLn("MOVE " + t + "(PC,D0.W),D0")
+	EmitLn("JMP " + t + "(PC,D0.W)")
+	PostLabel(t)
+	for v := low; v <= high; v++ {
+		target := other
+		for _, c := range labels {
+			if v >= c.Low && v <= c.High {
+				target = c.Target
+			}
+		}
+		EmitLn("DC.W " + target + "-" + t)
+	}
+}
+
+// CompareChain Dispatches on D0 Through a Sequence of Compares
+func CompareChain(labels []CaseLabel, other string) {
+	for _, c := range labels {
+		if c.Low == c.High {
+			EmitLn("CMP #" + strconv.Itoa(c.Low) + ",D0")
+			EmitLn("BEQ " + c.Target)
+		} else {
+			l := NewLabel()
+			EmitLn("CMP #" + strconv.Itoa(c.Low) + ",D0")
+			EmitLn("BLT " + l)
+			EmitLn("CMP #" + strconv.Itoa(c.High) + ",D0")
+			EmitLn("BLE " + c.Target)
+			PostLabel(l)
+		}
+	}
+	Branch(other)
+}
+
+// DoCase Parses and Translates a CASE Statement
+// The arms are emitted in source order ahead of the dispatch code, since the
+// labels must all be known before a jump table can be laid out. The selector
+// is left in D0 and survives the branch over the arms.
+func DoCase() {
+	Next()
+	Nesting++
+	BoolExpression()
+	MatchString("OF")
+	l1 := NewLabel()
+	l2 := NewLabel()
+	other := l2
+	Branch(l1)
+	var labels []CaseLabel
+	for IsCaseLabel(Token) {
+		target := NewLabel()
+		labels = CaseLabelList(target, labels)
+		MatchString(":")
+		PostLabel(target)
+		Block()
+		Branch(l2)
+	}
+	if Token == 'o' {
+		Next()
+		other = NewLabel()
+		PostLabel(other)
+		Block()
+		Branch(l2)
+	}
+	MatchString("ENDCASE")
+	Nesting--
+	PostLabel(l1)
+	if IsDense(labels) {
+		JumpTable(labels, other)
+	} else {
+		CompareChain(labels, other)
+	}
+	PostLabel(l2)
+}
+
 // ReadVar Reads Variable to Primary Register
 func ReadVar() {
 	CheckIdent()
 	CheckTable(Value)
-	ReadIt(Value)
+	name := Value
 	Next()
+	if IsArray(name) {
+		Index(name)
+		Push()
+		ReadElement(name)
+	} else {
+		ReadIt(name)
+	}
 }
 
 // DoRead Processes a Read Statement
@@ -728,16 +1610,25 @@ func DoRead() {
 	MatchString(")")
 }
 
+// WriteItem Writes an Expression or a String Literal
+func WriteItem() {
+	if Token == '"' {
+		WriteStr(AddString(Value))
+		Next()
+	} else {
+		Expression()
+		WriteIt()
+	}
+}
+
 // DoWrite Processes a Write Statement
 func DoWrite() {
 	Next()
 	MatchString("(")
-	Expression()
-	WriteIt()
+	WriteItem()
 	for Token == ',' {
 		Next()
-		Expression()
-		WriteIt()
+		WriteItem()
 	}
 	MatchString(")")
 }
@@ -745,22 +1636,38 @@ func DoWrite() {
 // Block Parses and Translates a Block of Statements
 func Block() {
 	Scan()
-	for Token != 'e' && Token != 'l' {
-		switch Token {
-		case 'i':
-			DoIf()
-		case 'w':
-			DoWhile()
-		case 'R':
-			DoRead()
-		case 'W':
-			DoWrite()
-		default:
+	for Token != 'e' && Token != 'l' && Token != 'o' && !IsCaseLabel(Token) &&
+		Token != 0x1A {
+		Statement()
+		Scan()
+	}
+}
+
+// Statement Parses and Translates a Single Statement
+// An error in the statement is recorded, and parsing resumes after it.
+func Statement() {
+	defer RecoverStatement(Nesting, TokenCount)
+	switch Token {
+	case 'i':
+		DoIf()
+	case 'w':
+		DoWhile()
+	case 'c':
+		DoCase()
+	case 'R':
+		DoRead()
+	case 'W':
+		DoWrite()
+	case 'v', 'p':
+		Abort("Declarations Must Come Before BEGIN")
+	default:
+		if Token == 'x' && IsProc(Value) {
+			CallProc()
+		} else {
 			Assignment()
 		}
-		Semi()
-		Scan()
 	}
+	Semi()
 }
 
 // Alloc Allocates Storage for a Variable
@@ -771,91 +1678,368 @@ func Alloc() {
 	}
 	CheckDup(Value)
 	AddEntry(Value, 'v')
-	Allocate(Value, "0")
+	name := Value
+	Next()
+	if Token == '[' {
+		Next()
+		size := ArraySize()
+		Locate(name).Size = size
+		AllocateArray(name, size)
+		MatchString("]")
+	} else {
+		Allocate(name, "0")
+	}
+}
+
+// ArraySize Gets the Number of Elements in an Array Declaration
+func ArraySize() int {
+	if Token != '#' {
+		Expected("Array Size")
+	}
+	n, err := strconv.Atoi(Value)
+	if err != nil || n == 0 {
+		Abort("Invalid Array Size " + Value)
+	}
+	if n > MaxArraySize {
+		Abort("Array Size Must Not Exceed " + strconv.Itoa(MaxArraySize))
+	}
 	Next()
+	return n
 }
 
 // TopDecls Parses and Translates Global Declarations
 func TopDecls() {
+	Scan()
+	for Token == 'v' || Token == 'p' {
+		if Token == 'v' {
+			Decl()
+		} else {
+			DoProc()
+		}
+		Scan()
+	}
+}
+
+// DoProc Parses and Translates a Procedure Declaration
+// The parameters and locals are declared in a scope of their own, which is
+// dropped at the end of the procedure, even if it has errors. The procedure
+// itself is declared before its body, so it may call itself.
+func DoProc() {
+	defer Recover()
+	Next()
+	CheckIdent()
+	name := Value
+	AddEntry(name, 'p')
+	Next()
+	ST.Push()
+	defer ST.Pop()
+	ProcHeading(name)
+	k := LocDecls()
+	ProcProlog(name, k)
+	MatchString("BEGIN")
+	Block()
+	MatchString("END")
+	ProcEpilog()
+	DeclSemi()
+}
+
+// ProcHeading Parses the Formal Parameters of a Procedure
+// An error in them is recorded, and parsing resumes after the heading.
+func ProcHeading(name string) {
+	defer Recover()
+	Locate(name).Params = FormalList()
+	DeclSemi()
+}
+
+// FormalList Processes the Formal Parameter List of a Procedure
+// The caller pushes the arguments in order, so the last one is nearest the
+// frame, just above the return address.
+func FormalList() (formals []*symtab.Entry) {
+	if Token != '(' {
+		return
+	}
+	Next()
+	if Token != ')' {
+		formals = append(formals, FormalParam())
+		for Token == ',' {
+			Next()
+			formals = append(formals, FormalParam())
+		}
+	}
+	MatchString(")")
+	for i, e := range formals {
+		e.Offset = 8 + 2*(len(formals)-1-i)
+	}
+	return
+}
+
+// FormalParam Processes a Formal Parameter
+func FormalParam() *symtab.Entry {
+	CheckIdent()
+	AddEntry(Value, 'f')
+	e := Locate(Value)
+	Next()
+	return e
+}
+
+// LocDecls Parses and Translates Local Declarations
+// Returns the number of locals.
+func LocDecls() (n int) {
 	Scan()
 	for Token == 'v' {
-		Alloc()
+		LocDeclList(&n)
+		Scan()
+	}
+	return
+}
+
+// LocDeclList Parses and Translates One VAR of Local Declarations
+// n is the number of locals declared so far. An error in the declarations is
+// recorded, and parsing resumes after them.
+func LocDeclList(n *int) {
+	defer Recover()
+	*n++
+	LocDecl(-2 * *n)
+	for Token == ',' {
+		*n++
+		LocDecl(-2 * *n)
+	}
+	DeclSemi()
+}
+
+// LocDecl Parses and Translates a Local Data Declaration
+// The local is given the frame offset passed in.
+func LocDecl(offset int) {
+	Next()
+	if Token != 'x' {
+		Expected("Variable Name")
+	}
+	AddEntry(Value, 'v')
+	Locate(Value).Offset = offset
+	Next()
+	if Token == '[' {
+		Abort("Local Arrays are Not Supported")
+	}
+}
+
+// CallProc Parses and Translates a Procedure Call
+func CallProc() {
+	name := Value
+	pos := TokenPos
+	Next()
+	n := ParamList()
+	CheckParamCount(name, len(Locate(name).Params), n, pos)
+	Call(name)
+	CleanStack(2 * n)
+}
+
+// CheckParamCount Checks the Number of Actual Parameters in a Call
+// The error is reported at pos, where the call began, rather than at the end
+// of the argument list.
+func CheckParamCount(name string, formals int, actuals int, pos Pos) {
+	if actuals != formals {
+		s := "Wrong Number of Parameters for " + name + ": Expected " +
+			strconv.Itoa(formals) + ", Found " + strconv.Itoa(actuals)
+		AbortAt(pos, s)
+	}
+}
+
+// ParamList Processes an Actual Parameter List for a Procedure Call
+// Returns the number of parameters pushed.
+func ParamList() (n int) {
+	if Token != '(' {
+		return
+	}
+	Next()
+	if Token != ')' {
+		Param()
+		n++
 		for Token == ',' {
-			Alloc()
+			Next()
+			Param()
+			n++
 		}
-		Semi()
 	}
+	MatchString(")")
+	return
+}
+
+// Param Processes an Actual Parameter
+func Param() {
+	BoolExpression()
+	Push()
+}
+
+// Decl Parses and Translates a Single Declaration
+func Decl() {
+	defer Recover()
+	Alloc()
+	for Token == ',' {
+		Alloc()
+	}
+	DeclSemi()
 }
 
 // Semi Matches a semicolon
+// A separator may only be left out before the end of a block.
 func Semi() {
-	MatchString(";")
-	/*
-		if Token == ';' {
-			Next()
+	switch {
+	case Token == ';':
+		Next()
+	case Lang.Semicolons == Terminator:
+		MissingSemi()
+	case Lang.Semicolons == Separator:
+		Scan()
+		if Token != 'e' && Token != 'l' && Token != 'o' && !IsCaseLabel(Token) {
+			MissingSemi()
 		}
-	*/
+	}
+}
+
+// MissingSemi Reports a Missing Semicolon
+// If the next token is one parsing could resume before anyway, the semicolon
+// is taken as read and the statement is not abandoned.
+func MissingSemi() {
+	Scan()
+	if IsResumePoint() {
+		Report("; Expected")
+		return
+	}
+	Expected(";")
+}
+
+// DeclSemi Matches the Semicolon After a Declaration
+// Only the Optional role lets it be left out.
+func DeclSemi() {
+	switch {
+	case Token == ';':
+		Next()
+	case Lang.Semicolons != Optional:
+		MissingSemi()
+	}
 }
 
 // SkipComment Skips a Comment Field
-func SkipComment() {
-	for Look != '/' {
-		for Look != '*' {
+// The opening of the comment is the lookahead character. The comment is read
+// raw, so on return the lookahead character has not been checked for the
+// opening of another comment.
+func SkipComment(c Comment) {
+	open, close := []rune(c.Open), []rune(c.Close)
+	if len(close) == 0 {
+		for Look != 0x0D && Look != 0x1A {
 			GetCharX()
-			// Note: Tutorial suggests that nested C-style comments only need 1 line
-			// of code change in SkipComment, but I could only get it to work by
-			// testing for both / and * before recursing
-			if Look == '/' {
-				GetCharX()
-				if Look == '*' {
-					SkipComment()
-				}
-			}
 		}
-		GetCharX()
+		return
 	}
 	GetCharX()
-}
-
-// SkipOneSidedComment Skips a One Sided Comment Field
-func SkipOneSidedComment() {
-	for Look != 0x0D {
-		GetCharX()
+	for {
+		switch {
+		case Look == 0x1A:
+			Abort("Unterminated Comment")
+		case Look == close[0]:
+			GetCharX()
+			if len(close) == 1 {
+				return
+			}
+			if Look == close[1] {
+				GetCharX()
+				return
+			}
+		case Lang.NestComments && Look == open[0]:
+			if len(open) == 1 {
+				SkipComment(c)
+			} else if GetCharX(); Look == open[1] {
+				SkipComment(c)
+			}
+		default:
+			GetCharX()
+		}
 	}
-	GetChar()
 }
 
-// GetChar Reads New Character. Intercepts '/*'
+// GetChar Reads New Character. Intercepts the Opening of a Comment
 func GetChar() {
-	if TempChar != ' ' {
+	if TempChar != 0 {
 		Look = TempChar
-		TempChar = ' '
+		LookPos = tempPos
+		TempChar = 0
 	} else {
 		GetCharX()
-		if Look == '/' {
-			TempChar = util.Read()
-			if TempChar == '*' {
-				Look = 0xFF
-				TempChar = ' '
-			} else if TempChar == '/' {
-				Look = 0xFE
-				TempChar = ' '
-			}
+	}
+	Intercept()
+}
+
+// Intercept Replaces the Opening of a Comment with its Comment Mark
+// A two character opening needs the next character too, which is held in
+// TempChar if it turns out not to be part of a comment.
+func Intercept() {
+	for i, c := range Lang.Comments {
+		open := []rune(c.Open)
+		if Look != open[0] {
+			continue
+		}
+		if len(open) == 1 {
+			Look = CommentMark + rune(i)
+			return
+		}
+		if TempChar == 0 {
+			TempChar = ReadChar()
+			tempPos = readPos
+		}
+		if TempChar == open[1] {
+			Look = CommentMark + rune(i)
+			TempChar = 0
+			return
 		}
 	}
 }
 
 // Init Initializes
 func Init() {
-	ST = make([]string, MaxEntry)
-	SType = make([]rune, MaxEntry)
+	readPos = Pos{1, 0}
+	TempChar = 0
+	TokenCount = 0
+	Diagnostics = nil
+	lastError = 0
+	Nesting = 0
+	Strings = nil
+	ST = symtab.New()
 	GetChar()
 	Next()
 }
 
-// Go starts the execution of this chapter
-func Go() {
+// StartCFG Starts Recording the Control Flow Graph, if One Was Asked For
+func StartCFG() (g *cfg.Graph) {
+	if CFGFile != "" {
+		g = cfg.New()
+		util.Tee = g
+	}
+	return
+}
+
+// WriteCFG Writes the Recorded Control Flow Graph to CFGFile
+func WriteCFG(g *cfg.Graph) {
+	if g == nil {
+		return
+	}
+	util.Tee = nil
+	if err := g.WriteFile(CFGFile); err != nil {
+		Abort(err.Error())
+	}
+}
+
+// Compile Compiles a Program, Returning Every Error Found
+// Errors outside of a statement or declaration still stop the compile.
+func Compile() (d []Diagnostic) {
+	defer func() {
+		if r := recover(); r != nil && r != "Aborted" {
+			panic(r)
+		}
+		d = Diagnostics
+	}()
 	Init()
+	g := StartCFG()
+	defer func() { util.Tee = nil }()
 	MatchString("PROGRAM")
 	Header()
 	TopDecls()
@@ -864,4 +2048,16 @@ func Go() {
 	Block()
 	MatchString("END")
 	Epilog()
+	WriteCFG(g)
+	return
+}
+
+// Go starts the execution of this chapter
+func Go() {
+	Compile()
+	if len(Diagnostics) > 0 {
+		util.WriteBlankLine()
+		util.WriteLine(strconv.Itoa(len(Diagnostics)) + " Error(s)")
+		panic("Aborted")
+	}
 }
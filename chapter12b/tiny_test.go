@@ -0,0 +1,147 @@
+package tiny
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dcw303/crenshaw-go/util"
+)
+
+// compile compiles src in the given dialect, returning its diagnostics
+func compile(t *testing.T, lang Dialect, src string) []string {
+	t.Helper()
+	var out strings.Builder
+	util.Source = strings.NewReader(src)
+	util.Screen = &out
+	Lang = lang
+	defer func() {
+		util.Source = nil
+		util.Screen = nil
+		Lang = CDialect
+	}()
+	var got []string
+	for _, d := range Compile() {
+		got = append(got, d.String())
+	}
+	return got
+}
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name string
+		lang Dialect
+		src  string
+		want []string
+	}{
+		{"bad IF condition", CDialect, `program
+var a, b;
+begin
+  if a < ) b = 1; endif;
+  a = 2;
+  while a b = 1; endwhile;
+end.
+`, []string{"4:10: Math Factor Expected"}},
+		{"nested structure in abandoned IF", CDialect, `program
+var a, b;
+begin
+  if a < ) while b b = 1; endwhile; endif;
+  a = 2;
+end.
+`, []string{"4:10: Math Factor Expected"}},
+		{"duplicate CASE label", CDialect, `program
+var a, b;
+begin
+  case a of
+  1: b = 1;
+  1: b = 2;
+  endcase;
+  a = 2;
+end.
+`, []string{"6:4: Duplicate Case Label"}},
+		{"missing expression before END", CDialect, `program
+var a;
+begin
+  a =
+end.
+`, []string{"5:1: Undefined Identifier END"}},
+		{"wrong end keyword", CDialect, `program
+var a, b;
+begin
+  if a b = 1; endwhile;
+  a = 2;
+end.
+`, []string{"4:15: ENDIF Expected"}},
+		{"declaration after BEGIN", CDialect, `program
+var a;
+begin
+  var b;
+  a = 1;
+end.
+`, []string{"4:3: Declarations Must Come Before BEGIN"}},
+		{"missing ENDIF", CDialect, `program
+var a, b;
+begin
+  if a b = 1;
+end.
+`, []string{"5:1: ENDIF Expected"}},
+		{"bad condition, Pascal", PascalDialect, `program
+var a, b;
+begin
+  if a < ) b = 1 end;
+  a = 2
+end.
+`, []string{"4:10: Math Factor Expected"}},
+		{"missing semicolon before BEGIN", CDialect, `program
+var a
+begin
+  a = 1;
+end.
+`, []string{"3:1: ; Expected"}},
+		{"missing semicolons in procedure", CDialect, `program
+var a;
+procedure p(x)
+var y
+begin
+  y = x;
+end
+begin
+  p(a);
+end.
+`, []string{"4:1: ; Expected", "5:1: ; Expected", "8:1: ; Expected"}},
+		{"wrong number of parameters", CDialect, `program
+var a;
+procedure p(x, y);
+begin
+end;
+begin
+  p(a,
+    a,
+    a);
+end.
+`, []string{"7:3: Wrong Number of Parameters for P: Expected 2, Found 3"}},
+	}
+	for _, tt := range tests {
+		got := compile(t, tt.lang, tt.src)
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestArraySize(t *testing.T) {
+	tests := []struct {
+		size string
+		want []string
+	}{
+		{"16384", nil},
+		{"16385", []string{"2:7: Array Size Must Not Exceed 16384"}},
+		{"0", []string{"2:7: Invalid Array Size 0"}},
+	}
+	for _, tt := range tests {
+		src := "program\nvar a[" + tt.size + "];\nbegin\nend.\n"
+		got := compile(t, CDialect, src)
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("size %s: got %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
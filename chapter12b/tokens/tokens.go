@@ -0,0 +1,127 @@
+// Package tokens exposes the TINY scanner of chapter 12 as a stream of tokens,
+// for tools that want to look at the lexical structure of a program.
+package tokens
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/dcw303/crenshaw-go/chapter12b"
+	"github.com/dcw303/crenshaw-go/util"
+)
+
+// Token is a Scanned Token
+// Text is the token as it was spelled in the source.
+type Token struct {
+	Kind tiny.TokenCode
+	Text string
+	Pos  tiny.Pos
+}
+
+// Scanner Iterates Over the Tokens of a Source
+// The TINY scanner keeps its state in package variables, so only one Scanner
+// can be in use at a time.
+type Scanner struct {
+	tok     Token
+	lines   []string
+	out     strings.Builder
+	err     error
+	started bool
+	done    bool
+}
+
+// NewScanner Starts Scanning the TINY Source Read from r
+func NewScanner(r io.Reader) *Scanner {
+	s := &Scanner{}
+	src, err := io.ReadAll(r)
+	if err != nil {
+		s.err = err
+		s.done = true
+		return s
+	}
+	text := strings.ReplaceAll(string(src), "\r", "")
+	s.lines = strings.Split(text, "\n")
+	util.Source = strings.NewReader(text)
+	util.Screen = &s.out
+	s.guard(tiny.Init)
+	return s
+}
+
+// Next Scans the Next Token, Returning false at the End of the Source
+// It also returns false at a lexical error, which is then reported by Err.
+func (s *Scanner) Next() bool {
+	if s.done {
+		return false
+	}
+	found := false
+	s.guard(func() {
+		// Init has already scanned the first token
+		if s.started {
+			tiny.Next()
+		}
+		s.started = true
+		if tiny.Token == 0x1A {
+			s.Close()
+			return
+		}
+		tiny.Scan()
+		s.tok = Token{tiny.TokenCode(tiny.Token), s.spelling(), tiny.TokenPos}
+		found = true
+	})
+	return found
+}
+
+// guard runs a step of the scanner, stopping the scan if it aborts
+func (s *Scanner) guard(step func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != "Aborted" {
+				panic(r)
+			}
+			msg := strings.TrimSpace(strings.ReplaceAll(s.out.String(), "\r", "\n"))
+			if i := strings.LastIndex(msg, "Error: "); i >= 0 {
+				msg = msg[i+len("Error: "):]
+			}
+			s.err = errors.New(msg)
+			s.Close()
+		}
+	}()
+	step()
+}
+
+// spelling returns the source text of the current token
+// Tokens never span lines, so a token ending on a later line runs to the end
+// of the line it started on.
+func (s *Scanner) spelling() string {
+	from, to := tiny.TokenPos, tiny.LookPos
+	if from.Line < 1 || from.Line > len(s.lines) {
+		return tiny.Value
+	}
+	line := []rune(s.lines[from.Line-1])
+	end := len(line)
+	if to.Line == from.Line && to.Col-1 < end {
+		end = to.Col - 1
+	}
+	if from.Col < 1 || from.Col-1 > end {
+		return tiny.Value
+	}
+	return string(line[from.Col-1 : end])
+}
+
+// Token Returns the Token Found by the Last Call to Next
+func (s *Scanner) Token() Token {
+	return s.tok
+}
+
+// Err Returns the Error that Stopped the Scan, or nil at the End of the Source
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Close Stops Scanning and Releases the Source
+func (s *Scanner) Close() {
+	s.done = true
+	util.Source = nil
+	util.Screen = nil
+}
@@ -1,4 +1,9 @@
-//this is the version of the package with call-by-value semantics
+//this is the version of the package with call-by-value semantics. A formal
+//parameter marked with v, as in pd(e,vf), is passed by reference instead.
+//Procedures may be nested, and reach the variables of the procedures around
+//them through a static link. A procedure or function may be declared
+//FORWARD with w after its parameters, and defined later. A g after the
+//parameters passes the first four of them in D1-D4 instead of on the stack
 
 /* Sample test
 va
@@ -19,6 +24,96 @@ d(b,c)
 e.
 */
 
+/* Sample VAR parameter test
+va
+vb
+ps(vx,y)
+b
+x=y
+e
+Pm
+b
+s(a,b)
+e.
+*/
+
+/* Sample nested procedure test
+va
+po(x)
+vy
+pi(z)
+b
+y=z
+x=a
+e
+b
+i(x)
+e
+Pm
+b
+o(a)
+e.
+*/
+
+/* Sample FORWARD test
+va
+pd(x)
+w
+pg(y)
+b
+d(y)
+e
+pd(x)
+b
+g(x)
+e
+Pm
+b
+d(a)
+e.
+*/
+
+/* Sample register parameter test
+va
+vb
+fs(x,y)
+g
+b
+rx+y
+e
+Pm
+b
+a=s(a,b)
+e.
+*/
+
+/* Sample expression test
+va
+vb
+pd(x,y)
+vz
+b
+z=(x+y)*2-a/3
+a=z>x&!(y=b)|-z
+e
+Pm
+b
+d(a+1,b*a)
+e.
+*/
+
+/* Sample function test
+va
+fs(x)
+b
+rx
+e
+Pm
+b
+a=s(a)
+e.
+*/
+
 package calls
 
 import (
@@ -26,6 +121,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/dcw303/crenshaw-go/symtab"
 	"github.com/dcw303/crenshaw-go/util"
 )
 
@@ -33,19 +129,49 @@ import (
 var Look rune
 
 // ST is a Symbol Table
-var ST map[rune]rune
+var ST *symtab.Table
+
+// InFunction is Set While Compiling the Body of a Function
+var InFunction bool
+
+// RegisterCalls Selects the Register Calling Convention for Every Procedure
+// Without it, a procedure uses registers only if it is marked with g.
+var RegisterCalls bool
 
-// Params is a Table of Function Parameters
-var Params map[rune]int
+// ParamRegs are the Registers Parameters are Passed In
+var ParamRegs = []string{"D1", "D2", "D3", "D4"}
 
-// NumParams is the Number of Parameters
-var NumParams int
+// Formals are the Formal Parameters of the Procedure Being Compiled
+var Formals []*symtab.Entry
 
-// Base is Used to Compute Stack Offsets
-var Base int
+// Reloads are the Register Parameters Spilled for the Call Being Compiled
+var Reloads []*symtab.Entry
+
+// FrameSize is the Number of Words in the Frame of the Procedure Being
+// Compiled, and FrameSym the Symbol its LINK Takes the Size From
+// A procedure with parameters in registers only learns how big its frame is
+// once its body has been compiled, as a slot is added for each parameter whose
+// address is taken. Its LINK uses a symbol, defined after the body.
+var (
+	FrameSize int
+	FrameSym  string
+)
+
+// Line is the Line Number of the Lookahead Character
+var Line int
+
+// Forwards Lists the Procedures Declared FORWARD
+var Forwards []*symtab.Entry
+
+// ForwardCalls Records the Lines of the Calls Made to Each Procedure While
+// it was Still Only Declared FORWARD
+var ForwardCalls map[*symtab.Entry][]int
 
 // GetChar Reads New Character From Input Stream
 func GetChar() {
+	if Look == 0x0D {
+		Line++
+	}
 	Look = util.Read()
 }
 
@@ -77,24 +203,30 @@ func Duplicate(n string) {
 }
 
 // TypeOf Gets Type of Symbol
+// Parameters and locals are both reported as 'f'.
 func TypeOf(n rune) rune {
 	if IsParam(n) {
 		return 'f'
 	}
-	return ST[n]
+	if e, ok := ST.Lookup(string(n)); ok {
+		return rune(e.Kind)
+	}
+	return ' '
 }
 
 // InTable Looks for Symbol in Table
 func InTable(n rune) bool {
-	return ST[n] != ' '
+	_, ok := ST.Lookup(string(n))
+	return ok
 }
 
 // AddEntry Adds a New Entry to Symbol Table
-func AddEntry(name rune, t rune) {
-	if InTable(name) {
+func AddEntry(name rune, t rune) *symtab.Entry {
+	e, err := ST.Add(symtab.Entry{Name: string(name), Kind: symtab.Kind(t)})
+	if err != nil {
 		Duplicate(string(name))
 	}
-	ST[name] = t
+	return e
 }
 
 // CheckVar Checks an Entry to Make Sure It's a Variable
@@ -172,6 +304,7 @@ func Match(x rune) {
 	} else {
 		Expected(strconv.QuoteRuneToASCII(x))
 	}
+	SkipWhite()
 }
 
 // GetName Gets an Identifier
@@ -225,51 +358,397 @@ func StoreVar(name rune) {
 	EmitLn("MOVE D0,(A0)")
 }
 
-// Expression Parses and Translates an Expression
-// Vestigal Version
-func Expression() {
-	name := GetName()
+// Clear Clears the Primary Register
+func Clear() {
+	EmitLn("CLR D0")
+}
+
+// Negate Negates the Primary Register
+func Negate() {
+	EmitLn("NEG D0")
+}
+
+// NotIt Complements the Primary Register
+func NotIt() {
+	EmitLn("NOT D0")
+}
+
+// LoadConst Loads a Constant Value to Primary Register
+func LoadConst(n string) {
+	EmitLn("MOVE #" + n + ",D0")
+}
+
+// PopAdd Adds Top of Stack to Primary
+func PopAdd() {
+	EmitLn("ADD (SP)+,D0")
+}
+
+// PopSub Subtracts Primary from Top of Stack
+func PopSub() {
+	EmitLn("SUB (SP)+,D0")
+	EmitLn("NEG D0")
+}
+
+// PopMul Multiplies Top of Stack by Primary
+func PopMul() {
+	EmitLn("MULS (SP)+,D0")
+}
+
+// PopDiv Divides Top of Stack by Primary
+func PopDiv() {
+	EmitLn("MOVE (SP)+,D7")
+	EmitLn("EXT.L D7")
+	EmitLn("DIVS D0,D7")
+	EmitLn("MOVE D7,D0")
+}
+
+// PopAnd ANDs Top of Stack with Primary
+func PopAnd() {
+	EmitLn("AND (SP)+,D0")
+}
+
+// PopOr ORs Top of Stack with Primary
+func PopOr() {
+	EmitLn("OR (SP)+,D0")
+}
+
+// PopXor XORs Top of Stack with Primary
+func PopXor() {
+	EmitLn("EOR (SP)+,D0")
+}
+
+// PopCompare Compares Top of Stack with Primary
+func PopCompare() {
+	EmitLn("CMP (SP)+,D0")
+}
+
+// SetEqual Sets D0 if Compare was =
+func SetEqual() {
+	EmitLn("SEQ D0")
+	EmitLn("EXT D0")
+}
+
+// SetNEqual Sets D0 if Compare was !=
+func SetNEqual() {
+	EmitLn("SNE D0")
+	EmitLn("EXT D0")
+}
+
+// SetGreater Sets D0 If Compare was >
+func SetGreater() {
+	EmitLn("SLT D0")
+	EmitLn("EXT D0")
+}
+
+// SetLess Sets D0 if Compare was <
+func SetLess() {
+	EmitLn("SGT D0")
+	EmitLn("EXT D0")
+}
+
+// SetLessOrEqual Sets D0 if Compare was <=
+func SetLessOrEqual() {
+	EmitLn("SGE D0")
+	EmitLn("EXT D0")
+}
+
+// SetGreaterOrEqual Sets D0 if Compare was >=
+func SetGreaterOrEqual() {
+	EmitLn("SLE D0")
+	EmitLn("EXT D0")
+}
+
+// LoadName Loads the Value a Name Stands For to the Primary Register
+// Parameters and locals are looked for first, then functions and globals.
+func LoadName(name rune) {
 	if IsParam(name) {
-		LoadParam(ParamNumber(name))
+		LoadParam(name)
+	} else if TypeOf(name) == 'F' {
+		CallProc(name)
 	} else {
 		LoadVar(name)
 	}
 }
 
+// Factor Parses and Translates a Math Factor
+func Factor() {
+	switch {
+	case Look == '(':
+		Match('(')
+		BoolExpression()
+		Match(')')
+	case IsAlpha(Look):
+		LoadName(GetName())
+	default:
+		LoadConst(string(GetNum()))
+	}
+}
+
+// NegFactor Parses and Translates a Negative Factor
+func NegFactor() {
+	Match('-')
+	if IsDigit(Look) {
+		LoadConst("-" + string(GetNum()))
+	} else {
+		Factor()
+		Negate()
+	}
+}
+
+// FirstFactor Parses and Translates a Leading Factor
+func FirstFactor() {
+	switch Look {
+	case '+':
+		Match('+')
+		Factor()
+	case '-':
+		NegFactor()
+	default:
+		Factor()
+	}
+}
+
+// Multiply Recognizes and Translates a Multiply
+func Multiply() {
+	Match('*')
+	Factor()
+	PopMul()
+}
+
+// Divide Recognizes and Translates a Divide
+func Divide() {
+	Match('/')
+	Factor()
+	PopDiv()
+}
+
+// Term1 Is Common Code Used by Term and FirstTerm
+func Term1() {
+	for IsMulOp(Look) {
+		Push()
+		switch Look {
+		case '*':
+			Multiply()
+		case '/':
+			Divide()
+		}
+	}
+}
+
+// Term Parses and Translates a Math Term
+func Term() {
+	Factor()
+	Term1()
+}
+
+// FirstTerm Parses and Translates a Leading Term
+func FirstTerm() {
+	FirstFactor()
+	Term1()
+}
+
+// Add Recognizes and Translates an Add
+func Add() {
+	Match('+')
+	Term()
+	PopAdd()
+}
+
+// Subtract Recognizes and Translates a Subtract
+func Subtract() {
+	Match('-')
+	Term()
+	PopSub()
+}
+
+// Expression Parses and Translates a Math Expression
+func Expression() {
+	FirstTerm()
+	for IsAddOp(Look) {
+		Push()
+		switch Look {
+		case '+':
+			Add()
+		case '-':
+			Subtract()
+		}
+	}
+}
+
+// Equals Recognizes and Translates a Relational "Equals"
+func Equals() {
+	Match('=')
+	Expression()
+	PopCompare()
+	SetEqual()
+}
+
+// LessOrEqual Recognizes and Translates a Relational "Less Than or Equal"
+func LessOrEqual() {
+	Match('=')
+	Expression()
+	PopCompare()
+	SetLessOrEqual()
+}
+
+// NotEqual Recognizes and Translates a Relational "Not Equals"
+// It is written either # or <>.
+func NotEqual() {
+	Match(Look)
+	Expression()
+	PopCompare()
+	SetNEqual()
+}
+
+// Less Recognizes and Translates a Relational "Less Than"
+func Less() {
+	Match('<')
+	switch Look {
+	case '=':
+		LessOrEqual()
+	case '>':
+		NotEqual()
+	default:
+		Expression()
+		PopCompare()
+		SetLess()
+	}
+}
+
+// Greater Recognizes and Translates a Relational "Greater Than"
+func Greater() {
+	Match('>')
+	if Look == '=' {
+		Match('=')
+		Expression()
+		PopCompare()
+		SetGreaterOrEqual()
+	} else {
+		Expression()
+		PopCompare()
+		SetGreater()
+	}
+}
+
+// Relation Parses and Translates a Relation
+func Relation() {
+	Expression()
+	if IsRelOp(Look) {
+		Push()
+		switch Look {
+		case '=':
+			Equals()
+		case '#':
+			NotEqual()
+		case '<':
+			Less()
+		case '>':
+			Greater()
+		}
+	}
+}
+
+// NotFactor Parses and Translates a Boolean Factor with Leading NOT
+func NotFactor() {
+	if Look == '!' {
+		Match('!')
+		Relation()
+		NotIt()
+	} else {
+		Relation()
+	}
+}
+
+// BoolTerm Parses and Translates a Boolean Term
+func BoolTerm() {
+	NotFactor()
+	for Look == '&' {
+		Push()
+		Match('&')
+		NotFactor()
+		PopAnd()
+	}
+}
+
+// BoolOr Recognizes and Translates a Boolean OR
+func BoolOr() {
+	Match('|')
+	BoolTerm()
+	PopOr()
+}
+
+// BoolXor Recognizes and Translates an Exclusive OR
+func BoolXor() {
+	Match('~')
+	BoolTerm()
+	PopXor()
+}
+
+// BoolExpression Parses and Translates a Boolean Expression
+func BoolExpression() {
+	BoolTerm()
+	for IsOrOp(Look) {
+		Push()
+		switch Look {
+		case '|':
+			BoolOr()
+		case '~':
+			BoolXor()
+		}
+	}
+}
+
 // Assignment Parses and Translates an Assignment Statement
 func Assignment(name rune) {
 	Match('=')
-	Expression()
+	BoolExpression()
 	if IsParam(name) {
-		StoreParam(ParamNumber(name))
+		StoreParam(name)
 	} else {
 		StoreVar(name)
 	}
 }
 
 // DoBlock Parses and Translates a Block of Statements
-func DoBlock() {
+// Reports whether the block always ends by returning.
+func DoBlock() (returns bool) {
 	for Look != 'e' {
-		AssignOrProc()
+		if Look == 'r' {
+			DoReturn()
+			returns = true
+		} else {
+			AssignOrProc()
+		}
 		Fin()
 	}
+	return
 }
 
 // BeginBlock Parses and Translates a Begin-Block
-func BeginBlock() {
+// Reports whether the block always ends by returning.
+func BeginBlock() (returns bool) {
 	Match('b')
 	Fin()
-	DoBlock()
+	returns = DoBlock()
 	Match('e')
 	Fin()
+	return
+}
+
+// DoReturn Parses and Translates a RETURN Statement
+// The value is left in D0 as the result of the function.
+func DoReturn() {
+	Match('r')
+	if !InFunction {
+		Abort("RETURN Outside of a Function")
+	}
+	BoolExpression()
+	ProcEpilog()
 }
 
 // Alloc Allocates Storage for a Variable
 func Alloc(n rune) {
-	if InTable(n) {
-		Duplicate(string(n))
-	}
-	ST[n] = 'v'
+	AddEntry(n, 'v')
 	util.WriteLine(string(n) + ":\tDC 0")
 }
 
@@ -287,6 +766,8 @@ func TopDecls() {
 			Decl()
 		case 'p':
 			DoProc()
+		case 'f':
+			DoFunction()
 		case 'P':
 			DoMain()
 		default:
@@ -302,19 +783,137 @@ func Return() {
 }
 
 // DoProc Parses and Translates a Procedure Declaration
+// The parameters, locals and nested procedures are declared in a scope of
+// their own. Nested procedures are translated before the body, so their code
+// comes first.
 func DoProc() {
 	Match('p')
 	n := GetName()
-	if InTable(n) {
-		Duplicate(string(n))
+	e := Declare(n, 'p')
+	ST.Push()
+	formals := FormalList()
+	if Look == 'w' {
+		Forward(e, formals)
+		ST.Pop()
+		return
 	}
-	ST[n] = 'p'
-	FormalList()
+	Define(e, formals)
 	k := LocDecls()
+	outer, outerFormals := InFunction, Formals
+	outerSize, outerSym := FrameSize, FrameSym
+	InFunction = false
+	NestedDecls()
+	Formals = formals
+	OpenFrame(n, formals, k)
 	ProcProlog(n, k)
 	BeginBlock()
 	ProcEpilog()
-	ClearParams()
+	CloseFrame()
+	InFunction, Formals = outer, outerFormals
+	FrameSize, FrameSym = outerSize, outerSym
+	ST.Pop()
+}
+
+// Declare Declares a Procedure or Function
+// A name already declared FORWARD in the same scope is not a duplicate.
+func Declare(n rune, t rune) *symtab.Entry {
+	e, ok := ST.LookupLocal(string(n))
+	if ok && e.Forward && e.Kind == symtab.Kind(t) {
+		return e
+	}
+	return AddEntry(n, t)
+}
+
+// Forward Processes a FORWARD Declaration
+func Forward(e *symtab.Entry, formals []*symtab.Entry) {
+	Match('w')
+	Fin()
+	if e.Forward {
+		Duplicate(e.Name)
+	}
+	e.Forward = true
+	e.Params = formals
+	Forwards = append(Forwards, e)
+}
+
+// Define Gives a Procedure or Function its Parameters as it is Defined
+// The parameters must match any FORWARD declaration.
+func Define(e *symtab.Entry, formals []*symtab.Entry) {
+	if e.Forward {
+		match := len(formals) == len(e.Params)
+		for i := 0; match && i < len(formals); i++ {
+			match = formals[i].ByRef == e.Params[i].ByRef &&
+				formals[i].Reg == e.Params[i].Reg
+		}
+		if !match {
+			Abort("Parameters of " + e.Name + " Do Not Match its FORWARD Declaration")
+		}
+		e.Forward = false
+	}
+	e.Params = formals
+}
+
+// CheckForwards Reports Every Call to a Procedure that was Declared FORWARD
+// but Never Defined
+func CheckForwards() {
+	unresolved := false
+	for _, e := range Forwards {
+		if !e.Forward {
+			continue
+		}
+		unresolved = true
+		Error(e.Name + " is Declared FORWARD but Never Defined")
+		for _, l := range ForwardCalls[e] {
+			Error("Unresolved Call to " + e.Name + " at Line " + strconv.Itoa(l))
+		}
+	}
+	if unresolved {
+		Abort("Unresolved FORWARD Declarations")
+	}
+}
+
+// NestedDecls Parses and Translates Procedures Declared Inside Another
+func NestedDecls() {
+	for Look == 'p' || Look == 'f' {
+		if Look == 'p' {
+			DoProc()
+		} else {
+			DoFunction()
+		}
+	}
+}
+
+// DoFunction Parses and Translates a Function Declaration
+// Every path through the body must end with a RETURN, so no epilog is
+// needed after it.
+func DoFunction() {
+	Match('f')
+	n := GetName()
+	e := Declare(n, 'F')
+	ST.Push()
+	formals := FormalList()
+	if Look == 'w' {
+		Forward(e, formals)
+		ST.Pop()
+		return
+	}
+	Define(e, formals)
+	k := LocDecls()
+	outer, outerFormals := InFunction, Formals
+	outerSize, outerSym := FrameSize, FrameSym
+	InFunction = false
+	NestedDecls()
+	Formals = formals
+	OpenFrame(n, formals, k)
+	ProcProlog(n, k)
+	InFunction = true
+	if !BeginBlock() {
+		Abort("Function " + string(n) + " Can End Without a RETURN")
+	}
+	CloseFrame()
+	InFunction, Formals = outer, outerFormals
+	FrameSize, FrameSym = outerSize, outerSym
+	ST.Pop()
 }
 
 // DoMain Parses and Translates a Main Program
@@ -337,7 +936,7 @@ func AssignOrProc() {
 		Undefined(string(name))
 	case 'v', 'f':
 		Assignment(name)
-	case 'p':
+	case 'p', 'F':
 		CallProc(name)
 	default:
 		Abort("Identifier " + string(name) + " Cannot Be Used Here")
@@ -345,10 +944,102 @@ func AssignOrProc() {
 }
 
 // CallProc Processes a Procedure Call
+// A procedure passing parameters in registers saves its own around the call.
 func CallProc(name rune) {
-	n := ParamList()
+	saved := SaveRegs()
+	outer := Reloads
+	Reloads = nil
+	n := ParamList(name)
+	e, _ := ST.Lookup(string(name))
+	if e.Forward {
+		ForwardCalls[e] = append(ForwardCalls[e], Line)
+	}
+	n -= LoadRegs(e.Params)
+	n += PushLink(e.Level + 1)
 	Call(name)
 	CleanStack(n)
+	RestoreRegs(saved)
+	Reload()
+	Reloads = outer
+}
+
+// LoadRegs Moves the Parameters Passed in Registers Off the Stack
+// Every parameter is pushed as it is evaluated, as evaluating one may need
+// the registers. If they are all passed in registers they are popped,
+// otherwise they are copied and the stack is cleaned up after the call as
+// usual. Returns the number of bytes popped.
+func LoadRegs(formals []*symtab.Entry) int {
+	size := func(e *symtab.Entry) int {
+		if e.ByRef {
+			return 4
+		}
+		return 2
+	}
+	all := true
+	for _, e := range formals {
+		all = all && e.Reg != ""
+	}
+	popped := 0
+	offset := 0
+	for i := len(formals) - 1; i >= 0; i-- {
+		e := formals[i]
+		ext := ""
+		if e.ByRef {
+			ext = ".L"
+		}
+		switch {
+		case all:
+			EmitLn("MOVE" + ext + " (SP)+," + e.Reg)
+			popped += size(e)
+		case e.Reg != "":
+			EmitLn("MOVE" + ext + " " + strconv.Itoa(offset) + "(SP)," + e.Reg)
+		}
+		offset += size(e)
+	}
+	return popped
+}
+
+// SaveRegs Saves the Parameters of the Current Procedure Held in Registers
+// Returns the register list, for RestoreRegs.
+func SaveRegs() (list string) {
+	for _, e := range Formals {
+		if e.Reg == "" || e.Level != ST.Level() {
+			continue
+		}
+		if list != "" {
+			list += "/"
+		}
+		list += e.Reg
+	}
+	if list != "" {
+		EmitLn("MOVEM.L " + list + ",-(SP)")
+	}
+	return
+}
+
+// RestoreRegs Restores the Registers Saved by SaveRegs
+func RestoreRegs(list string) {
+	if list != "" {
+		EmitLn("MOVEM.L (SP)+," + list)
+	}
+}
+
+// PushLink Pushes the Static Link for a Call
+// level is the level of the body of the procedure being called. Only nested
+// procedures need a static link, which points to the frame of the procedure
+// they are declared in. Returns the number of bytes pushed.
+func PushLink(level int) int {
+	if level < 2 {
+		return 0
+	}
+	EmitLn("MOVE.L " + Link(ST.Level()-(level-1)) + ",-(SP)")
+	return 4
+}
+
+// Signature Gets the Formal Parameters of a Procedure or Function
+func Signature(name rune) []*symtab.Entry {
+	e, _ := ST.Lookup(string(name))
+	return e.Params
 }
 
 // Call Generates code to Emit BSR instruction
@@ -357,88 +1048,245 @@ func Call(name rune) {
 }
 
 // FormalList Processes the Formal Parameter List of a Procedure
-func FormalList() {
+// The caller pushes the parameters in order, so the offsets are worked out
+// from the last one, which is nearest the return address, or nearest the
+// static link of a nested procedure. A reference takes a long word.
+func FormalList() (formals []*symtab.Entry) {
 	Match('(')
 	if Look != ')' {
-		FormalParam()
+		formals = append(formals, FormalParam())
 		for Look == ',' {
 			Match(',')
-			FormalParam()
+			formals = append(formals, FormalParam())
 		}
 	}
 	Match(')')
 	Fin()
-	Base = NumParams
-	NumParams += 4
+	if Look == 'g' {
+		Match('g')
+		Fin()
+		AssignRegs(formals)
+	} else if RegisterCalls {
+		AssignRegs(formals)
+	}
+	offset := 8
+	if ST.Level() > 1 {
+		offset += 4
+	}
+	for i := len(formals) - 1; i >= 0; i-- {
+		if formals[i].Reg != "" {
+			continue
+		}
+		formals[i].Offset = offset
+		if formals[i].ByRef {
+			offset += 4
+		} else {
+			offset += 2
+		}
+	}
+	return
+}
+
+// AssignRegs Passes the First Parameters of a Procedure in Registers
+func AssignRegs(formals []*symtab.Entry) {
+	for i := 0; i < len(formals) && i < len(ParamRegs); i++ {
+		formals[i].Reg = ParamRegs[i]
+	}
+}
+
+// OpenFrame Starts the Frame of Procedure n with k Words of Locals
+// If a parameter held in a register could have its address taken, the size is
+// left to a symbol named after the procedure.
+func OpenFrame(n rune, formals []*symtab.Entry, k int) {
+	FrameSize, FrameSym = k, ""
+	for _, e := range formals {
+		if e.Reg != "" && !e.ByRef {
+			FrameSym = string(n) + "FRAME"
+			return
+		}
+	}
+}
+
+// CloseFrame Defines the Size of a Frame Left to a Symbol
+func CloseFrame() {
+	if FrameSym != "" {
+		util.WriteLine(FrameSym + "\tEQU " + strconv.Itoa(2*FrameSize))
+	}
+}
+
+// Spill Stores a Parameter Held in a Register in its Slot in the Frame
+// The slot is added to the frame the first time it is needed. The register is
+// still where the parameter lives, so it is reloaded from the slot once the
+// call that took its address returns.
+func Spill(e *symtab.Entry) {
+	if e.Offset == 0 {
+		FrameSize++
+		e.Offset = -2 * FrameSize
+	}
+	EmitLn("MOVE " + Home(e) + "," + strconv.Itoa(e.Offset) + "(A6)")
+	Reloads = append(Reloads, e)
+}
+
+// Reload Moves the Parameters Spilled for a Call Back into Their Registers
+func Reload() {
+	for _, e := range Reloads {
+		EmitLn("MOVE " + strconv.Itoa(e.Offset) + "(A6)," + e.Reg)
+	}
 }
 
 // FormalParam Processes a Formal Parameter
-func FormalParam() {
-	AddParam(GetName())
+func FormalParam() *symtab.Entry {
+	ref := false
+	if Look == 'v' {
+		Match('v')
+		ref = true
+	}
+	e := AddEntry(GetName(), 'f')
+	e.ByRef = ref
+	return e
 }
 
 // Param Processes an Actual Parameter
-func Param() {
-	Expression()
+// Returns the number of bytes pushed.
+func Param(formal *symtab.Entry) int {
+	if formal != nil && formal.ByRef {
+		RefParam()
+		return 4
+	}
+	BoolExpression()
 	Push()
+	return 2
+}
+
+// RefParam Pushes the Address of an Actual Parameter Passed by Reference
+func RefParam() {
+	if !IsAlpha(Look) {
+		Abort("VAR Parameter Must be a Variable")
+	}
+	name := GetName()
+	if Look != ',' && Look != ')' {
+		Abort("VAR Parameter Must be a Variable")
+	}
+	switch {
+	case IsParam(name) && Local(name).ByRef:
+		EmitLn("MOVE.L " + Home(Local(name)) + ",-(SP)")
+	case IsParam(name):
+		if Local(name).Reg != "" {
+			Spill(Local(name))
+		}
+		EmitLn("PEA " + Frame(Local(name)))
+	case TypeOf(name) == 'v':
+		EmitLn("PEA " + string(name) + "(PC)")
+	default:
+		Abort("VAR Parameter Must be a Variable")
+	}
 }
 
 // ParamList Processes the Parameter List for a Procedure Call
-func ParamList() int {
+// Returns the number of bytes pushed.
+func ParamList(name rune) int {
+	formals := Signature(name)
+	line := Line
 	n := 0
+	i := 0
 	Match('(')
 	if Look != ')' {
-		Param()
-		n++
+		n += Param(Formal(formals, i))
+		i++
 		for Look == ',' {
 			Match(',')
-			Param()
-			n++
+			n += Param(Formal(formals, i))
+			i++
 		}
 	}
 	Match(')')
-	return 2 * n
+	CheckParamCount(string(name), len(formals), i, line)
+	return n
 }
 
-// ClearParams Initializes Parameter Table to Null
-func ClearParams() {
-	for i := 'A'; i <= 'Z'; i++ {
-		Params[i] = 0
+// CheckParamCount Checks the Number of Actual Parameters in a Call
+// The line is where the call began, as the argument list may span several.
+func CheckParamCount(name string, formals int, actuals int, line int) {
+	if actuals != formals {
+		Abort("Wrong Number of Parameters for " + name + " at Line " +
+			strconv.Itoa(line) + ": Expected " + strconv.Itoa(formals) +
+			", Found " + strconv.Itoa(actuals))
 	}
-	NumParams = 0
 }
 
-// ParamNumber Finds the Parameter Number
-func ParamNumber(n rune) int {
-	return Params[n]
+// Formal Gets the ith Formal Parameter, or nil if There Isn't One
+func Formal(formals []*symtab.Entry, i int) *symtab.Entry {
+	if i < len(formals) {
+		return formals[i]
+	}
+	return nil
 }
 
-// IsParam Sees if an Identifer is a Parameter
+// IsParam Sees if an Identifer is a Parameter or Local
 func IsParam(n rune) bool {
-	return Params[n] != 0
+	return Local(n) != nil
 }
 
-// AddParam Adds a New Parameter to Table
-func AddParam(name rune) {
-	if IsParam(name) {
-		Duplicate(string(name))
+// Local Finds the Entry for a Parameter or Local, or nil if n is Not One
+func Local(n rune) *symtab.Entry {
+	e, ok := ST.Lookup(string(n))
+	if !ok || e.Level == 0 || (e.Kind != symtab.Var && e.Kind != symtab.Param) {
+		return nil
+	}
+	return e
+}
+
+// Link Loads the Frame Pointer of a Procedure Enclosing the Current One
+// The static links are followed out the given number of levels. Returns the
+// register holding the frame pointer.
+func Link(hops int) string {
+	if hops == 0 {
+		return "A6"
+	}
+	EmitLn("MOVE.L 8(A6),A1")
+	for ; hops > 1; hops-- {
+		EmitLn("MOVE.L 8(A1),A1")
+	}
+	return "A1"
+}
+
+// Frame Returns the Address of a Parameter or Local in its Frame
+func Frame(e *symtab.Entry) string {
+	return strconv.Itoa(e.Offset) + "(" + Link(ST.Level()-e.Level) + ")"
+}
+
+// Home Returns Where a Parameter or Local is Held, in a Register or its Frame
+func Home(e *symtab.Entry) string {
+	if e.Reg == "" {
+		return Frame(e)
+	}
+	if e.Level != ST.Level() {
+		Abort("Parameter " + e.Name + " is Passed in a Register and Cannot be " +
+			"Used by a Nested Procedure")
 	}
-	NumParams++
-	Params[name] = NumParams
+	return e.Reg
 }
 
 // LoadParam Loads a Parameter to the Primary Register
-func LoadParam(n int) {
-	offset := 8 + 2*(Base-n)
-	Emit("MOVE ")
-	util.WriteLine(strconv.Itoa(offset) + "(A6),D0")
+func LoadParam(name rune) {
+	e := Local(name)
+	if e.ByRef {
+		EmitLn("MOVE.L " + Home(e) + ",A0")
+		EmitLn("MOVE (A0),D0")
+	} else {
+		EmitLn("MOVE " + Home(e) + ",D0")
+	}
 }
 
 // StoreParam Stores a Parameter from the Primary Register
-func StoreParam(n int) {
-	offset := 8 + 2*(Base-n)
-	Emit("MOVE D0,")
-	util.WriteLine(strconv.Itoa(offset) + "(A6)")
+func StoreParam(name rune) {
+	e := Local(name)
+	if e.ByRef {
+		EmitLn("MOVE.L " + Home(e) + ",A0")
+		EmitLn("MOVE D0,(A0)")
+	} else {
+		EmitLn("MOVE D0," + Home(e))
+	}
 }
 
 // Push Pushes the Primary Register to the Stack
@@ -458,7 +1306,11 @@ func CleanStack(n int) {
 func ProcProlog(n rune, k int) {
 	PostLabel(string(n))
 	Emit("LINK A6,#")
-	util.WriteLine(strconv.Itoa(-2 * k))
+	if FrameSym != "" {
+		util.WriteLine("-" + FrameSym)
+	} else {
+		util.WriteLine(strconv.Itoa(-2 * k))
+	}
 }
 
 // ProcEpilog Writes the Epilog for a Procedure
@@ -478,9 +1330,10 @@ func Epilog() {
 }
 
 // LocDecl Parses and Translates a Local Data Declaration
-func LocDecl() {
+// The local is given the frame offset passed in.
+func LocDecl(offset int) {
 	Match('v')
-	AddParam(GetName())
+	AddEntry(GetName(), 'v').Offset = offset
 	Fin()
 }
 
@@ -488,22 +1341,22 @@ func LocDecl() {
 func LocDecls() int {
 	n := 0
 	for Look == 'v' {
-		LocDecl()
 		n++
+		LocDecl(-2 * n)
 	}
 	return n
 }
 
 // Init Initializes
 func Init() {
+	Line = 1
 	GetChar()
 	SkipWhite()
-	ST = make(map[rune]rune)
-	Params = make(map[rune]int)
-	for i := 'A'; i <= 'Z'; i++ {
-		ST[i] = ' '
-	}
-	ClearParams()
+	ST = symtab.New()
+	Forwards = nil
+	Formals = nil
+	FrameSize, FrameSym = 0, ""
+	ForwardCalls = make(map[*symtab.Entry][]int)
 }
 
 // Go starts the execution of this chapter
@@ -511,4 +1364,5 @@ func Go() {
 	Init()
 	TopDecls()
 	Epilog()
+	CheckForwards()
 }
@@ -23,6 +23,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/dcw303/crenshaw-go/symtab"
 	"github.com/dcw303/crenshaw-go/util"
 )
 
@@ -30,7 +31,7 @@ import (
 var Look rune
 
 // ST is a Symbol Table
-var ST map[rune]rune
+var ST *symtab.Table
 
 // Params is a Table of Function Parameters
 var Params map[rune]int
@@ -75,20 +76,24 @@ func TypeOf(n rune) rune {
 	if IsParam(n) {
 		return 'f'
 	}
-	return ST[n]
+	if e, ok := ST.Lookup(string(n)); ok {
+		return rune(e.Kind)
+	}
+	return ' '
 }
 
 // InTable Looks for Symbol in Table
 func InTable(n rune) bool {
-	return ST[n] != ' '
+	_, ok := ST.Lookup(string(n))
+	return ok
 }
 
 // AddEntry Adds a New Entry to Symbol Table
 func AddEntry(name rune, t rune) {
-	if InTable(name) {
+	_, err := ST.Add(symtab.Entry{Name: string(name), Kind: symtab.Kind(t)})
+	if err != nil {
 		Duplicate(string(name))
 	}
-	ST[name] = t
 }
 
 // CheckVar Checks an Entry to Make Sure It's a Variable
@@ -260,10 +265,7 @@ func BeginBlock() {
 
 // Alloc Allocates Storage for a Variable
 func Alloc(n rune) {
-	if InTable(n) {
-		Duplicate(string(n))
-	}
-	ST[n] = 'v'
+	AddEntry(n, 'v')
 	util.WriteLine(string(n) + ":\tDC 0")
 }
 
@@ -301,10 +303,7 @@ func DoProc() {
 	n := GetName()
 	FormalList()
 	Fin()
-	if InTable(n) {
-		Duplicate(string(n))
-	}
-	ST[n] = 'p'
+	AddEntry(n, 'p')
 	ProcProlog(n)
 	BeginBlock()
 	ProcEpilog()
@@ -472,11 +471,8 @@ func Epilog() {
 func Init() {
 	GetChar()
 	SkipWhite()
-	ST = make(map[rune]rune)
+	ST = symtab.New()
 	Params = make(map[rune]int)
-	for i := 'A'; i <= 'Z'; i++ {
-		ST[i] = ' '
-	}
 	ClearParams()
 }
 
@@ -11,6 +11,17 @@ c=b/a
 .
 */
 
+/* Sample strict test, with Strict set
+ba
+wb
+lc
+B
+b=a*100
+c=l(b)/l(a)
+a=b(c)
+.
+*/
+
 package types
 
 import (
@@ -18,6 +29,8 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/dcw303/crenshaw-go/number"
+	"github.com/dcw303/crenshaw-go/symtab"
 	"github.com/dcw303/crenshaw-go/util"
 )
 
@@ -25,7 +38,37 @@ import (
 var Look rune
 
 // ST is a Symbol Table
-var ST map[rune]rune
+var ST *symtab.Table
+
+// Strict Turns Off Automatic Conversions
+// Operands of different sizes can't be mixed and a value can't be stored in a
+// smaller variable unless it is converted with b(x), w(x) or l(x). Constants
+// are exempt from the mixing rule, as they are given the smallest size that
+// holds them, and may be stored in any variable their value fits.
+var Strict bool
+
+// Line and Col are the Position of the Lookahead Character
+var Line, Col int
+
+// Literal is Set While the Primary Register Holds a Constant, and Constant
+// is its Value
+var (
+	Literal  bool
+	Constant int64
+)
+
+// Operand is What is Known About a Value Pushed on the Stack
+type Operand struct {
+	Literal bool
+	Value   int64
+	At      string // position of the operator that follows it
+}
+
+// Pushed are the Operands on the Stack, and Popped the Last One Taken Off
+var (
+	Pushed []Operand
+	Popped Operand
+)
 
 // go doesn't have a built in abs function for int64
 func abs(x int64) int64 {
@@ -37,9 +80,22 @@ func abs(x int64) int64 {
 
 // GetChar Reads New Character From Input Stream
 func GetChar() {
+	switch Look {
+	case 0x0D:
+		Line++
+		Col = 1
+	case 0x0A:
+	default:
+		Col++
+	}
 	Look = util.Read()
 }
 
+// Here Reports the Position of the Lookahead Character
+func Here() string {
+	return "Line " + strconv.Itoa(Line) + ", Column " + strconv.Itoa(Col)
+}
+
 // Error Reports an Error
 func Error(s string) {
 	util.WriteBlankLine()
@@ -60,8 +116,8 @@ func Expected(s string) {
 // DumpTable Dumps the Sybol Table
 func DumpTable() {
 	for i := 'A'; i <= 'Z'; i++ {
-		if ST[i] != '?' {
-			util.WriteLine(string(i) + " " + string(ST[i]))
+		if InTable(i) {
+			util.WriteLine(string(i) + " " + string(TypeOf(i)))
 		}
 	}
 }
@@ -145,17 +201,9 @@ func GetName() (r rune) {
 
 // GetNum Gets a Number
 func GetNum() (val int64) {
-	if !IsDigit(Look) {
-		Expected("Integer")
-	}
-	val = 0
-	for IsDigit(Look) {
-		digit, err := strconv.Atoi(string(Look))
-		if err != nil {
-			panic(err)
-		}
-		val = 10*val + int64(digit)
-		GetChar()
+	val, err := number.Scan(func() rune { return Look }, GetChar, number.Long)
+	if err != nil {
+		Abort(err.Error())
 	}
 	SkipWhite()
 	return
@@ -174,7 +222,10 @@ func EmitLn(s string) {
 
 // TypeOf Reports Type of a Variable
 func TypeOf(n rune) rune {
-	return ST[n]
+	if e, ok := ST.Lookup(string(n)); ok {
+		return e.Type
+	}
+	return '?'
 }
 
 // InTable Reports if a Variable is in the Table
@@ -182,17 +233,12 @@ func InTable(n rune) bool {
 	return TypeOf(n) != '?'
 }
 
-// CheckDup Checks for a Duplicate Variable Name
-func CheckDup(n rune) {
-	if InTable(n) {
-		Abort("Duplicate Name " + string(n))
-	}
-}
-
 // AddEntry Adds Entry to Table
 func AddEntry(n rune, t rune) {
-	CheckDup(n)
-	ST[n] = t
+	_, err := ST.Add(symtab.Entry{Name: string(n), Kind: symtab.Var, Type: t})
+	if err != nil {
+		Abort("Duplicate Name " + string(n))
+	}
 }
 
 // Alloc Allocates Storage for a Variable
@@ -240,6 +286,24 @@ func IsVarType(r rune) bool {
 	return strings.ContainsRune("BWL", r)
 }
 
+// TypeName Returns the Name of a Type
+func TypeName(typ rune) string {
+	switch typ {
+	case 'B':
+		return "BYTE"
+	case 'W':
+		return "WORD"
+	case 'L':
+		return "LONG"
+	}
+	return string(typ)
+}
+
+// Rank Orders the Types by Size
+func Rank(typ rune) int {
+	return strings.IndexRune("BWL", typ)
+}
+
 // VarType Gets a Variable Type from the Symbol Table
 func VarType(name rune) rune {
 	typ := TypeOf(name)
@@ -253,6 +317,7 @@ func VarType(name rune) rune {
 func Load(name rune) rune {
 	typ := VarType(name)
 	LoadVar(name, typ)
+	Literal = false
 	return typ
 }
 
@@ -307,9 +372,12 @@ func Expression() (typ rune) {
 }
 
 // UnOp Processes a Term with Leading Unary Operator
+// The term is taken from a cleared register. The zero is given the smallest
+// type, so the result keeps the type of the term.
 func UnOp() rune {
 	Clear()
-	return 'W'
+	Literal, Constant = true, 0
+	return 'B'
 }
 
 // Clear Clears the Primary Register
@@ -322,6 +390,7 @@ func Clear() {
 // Push Pushes Primary onto Stack
 func Push(size rune) {
 	Move(size, "D0", "-(SP)")
+	Pushed = append(Pushed, Operand{Literal, Constant, Here()})
 }
 
 // Add Recognizes and Translates an Add
@@ -339,6 +408,8 @@ func Subtract(t1 rune) rune {
 // Pop Pops Stack into Secondary Register
 func Pop(size rune) {
 	Move(size, "(SP)+", "D7")
+	Popped = Pushed[len(Pushed)-1]
+	Pushed = Pushed[:len(Pushed)-1]
 }
 
 // Convert Convers a Data Item from One Type to Another
@@ -365,8 +436,71 @@ func Promote(t1, t2 rune, reg string) (typ rune) {
 	return
 }
 
+// CheckMix Checks the Operands of a Binary Operator in Strict Mode
+// The popped operand is the first. The result is a constant only if both
+// operands are.
+func CheckMix(t1, t2 rune) {
+	if Strict && t1 != t2 && !Popped.Literal && !Literal {
+		Abort("Mixed " + TypeName(t1) + " and " + TypeName(t2) +
+			" Operands at " + Popped.At)
+	}
+	Literal = Literal && Popped.Literal
+}
+
+// Fold Works Out the Value of an Operation on Two Constants
+// The code for the operation is still generated; the value is only used to
+// check the result fits where it is stored.
+func Fold(op rune) {
+	if !Literal {
+		return
+	}
+	a, b := Popped.Value, Constant
+	switch op {
+	case '+':
+		Constant = a + b
+	case '-':
+		Constant = a - b
+	case '*':
+		Constant = a * b
+	case '/':
+		if b == 0 {
+			Literal = false
+			return
+		}
+		Constant = a / b
+	}
+}
+
+// Fits Reports Whether a Constant Fits in a Type
+func Fits(n int64, typ rune) bool {
+	switch typ {
+	case 'B':
+		return n >= -128 && n <= 127
+	case 'W':
+		return n >= -32768 && n <= 32767
+	}
+	return true
+}
+
+// CheckNarrow Checks a Value of Type t1 Can be Stored in a t2 in Strict Mode
+// A constant can be stored anywhere its value fits, and nowhere else.
+func CheckNarrow(t1, t2 rune, at string) {
+	if Literal {
+		if Strict && !Fits(Constant, t2) {
+			Abort("Constant " + strconv.FormatInt(Constant, 10) +
+				" Does Not Fit in " + TypeName(t2) + " at " + at)
+		}
+		return
+	}
+	if Strict && Rank(t1) > Rank(t2) {
+		Abort("Cannot Store " + TypeName(t1) + " in " + TypeName(t2) +
+			" at " + at)
+	}
+}
+
 // SameType Forces both Arguments to Same Type
 func SameType(t1, t2 rune) rune {
+	CheckMix(t1, t2)
 	t1 = Promote(t1, t2, "D7")
 	return Promote(t2, t1, "D0")
 }
@@ -375,6 +509,7 @@ func SameType(t1, t2 rune) rune {
 func PopAdd(t1, t2 rune) rune {
 	Pop(t1)
 	t2 = SameType(t1, t2)
+	Fold('+')
 	GenAdd(t2)
 	return t2
 }
@@ -383,6 +518,7 @@ func PopAdd(t1, t2 rune) rune {
 func PopSub(t1, t2 rune) rune {
 	Pop(t1)
 	t2 = SameType(t1, t2)
+	Fold('-')
 	GenSub(t2)
 	return t2
 }
@@ -405,13 +541,28 @@ func Factor() (typ rune) {
 		typ = Expression()
 		Match(')')
 	} else if IsAlpha(Look) {
-		typ = Load(GetName())
+		name := GetName()
+		if Look == '(' && IsVarType(name) {
+			typ = Conversion(name)
+		} else {
+			typ = Load(name)
+		}
 	} else {
 		typ = LoadNum(GetNum())
 	}
 	return
 }
 
+// Conversion Parses and Translates an Explicit Type Conversion
+// The name of the conversion is the keyword declaring the type it converts to.
+func Conversion(typ rune) rune {
+	Match('(')
+	Convert(Expression(), typ, "D0")
+	Match(')')
+	Literal = false
+	return typ
+}
+
 // Multiply Recognizes and Translates a Multiply
 func Multiply(t1 rune) rune {
 	Match('*')
@@ -428,6 +579,7 @@ func Divide(t1 rune) rune {
 func PopMul(t1, t2 rune) rune {
 	Pop(t1)
 	t := SameType(t1, t2)
+	Fold('*')
 	Convert(t, 'W', "D7")
 	Convert(t, 'W', "D0")
 	if t == 'L' {
@@ -444,6 +596,8 @@ func PopMul(t1, t2 rune) rune {
 // PopDiv Generates Code to Divide Stack by the Primary
 func PopDiv(t1, t2 rune) rune {
 	Pop(t1)
+	CheckMix(t1, t2)
+	Fold('/')
 	Convert(t1, t2, "D7")
 	if t1 == 'L' || t2 == 'L' {
 		Convert(t2, 'L', "D0")
@@ -478,9 +632,12 @@ func GenLongMult() {
 
 // Assignment Parses and Translates an Assignment Statement
 func Assignment() {
+	at := Here()
 	name := GetName()
 	Match('=')
-	Store(name, Expression())
+	typ := Expression()
+	CheckNarrow(typ, VarType(name), at)
+	Store(name, typ)
 }
 
 // Block Parses and Transaltes a Block of Statements
@@ -502,6 +659,7 @@ func LoadNum(n int64) rune {
 		typ = 'L'
 	}
 	LoadConst(n, typ)
+	Literal, Constant = true, n
 	return typ
 }
 
@@ -513,10 +671,11 @@ func LoadConst(n int64, typ rune) {
 
 // Init Initializes
 func Init() {
-	ST = make(map[rune]rune)
-	for i := 'A'; i <= 'Z'; i++ {
-		ST[i] = '?'
-	}
+	ST = symtab.New()
+	Look = 0
+	Line, Col = 1, 0
+	Pushed, Popped = nil, Operand{}
+	Literal, Constant = false, 0
 	GetChar()
 	SkipWhite()
 }
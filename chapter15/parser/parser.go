@@ -9,7 +9,7 @@ import (
 
 // Factor Parses and Translates a Factor
 func Factor() {
-	if scanner.IsDigit(input.Look) {
+	if scanner.IsNumber(input.Look) {
 		codegen.LoadConstant(scanner.GetNumber())
 	} else if scanner.IsAlpha(input.Look) {
 		codegen.LoadVariable(scanner.GetName())
@@ -7,6 +7,7 @@ import (
 
 	"github.com/dcw303/crenshaw-go/chapter15/errors"
 	"github.com/dcw303/crenshaw-go/chapter15/input"
+	"github.com/dcw303/crenshaw-go/number"
 )
 
 // IsAlpha Recognizes an Alpha Character
@@ -19,6 +20,11 @@ func IsDigit(r rune) bool {
 	return unicode.IsDigit(r)
 }
 
+// IsNumber Recognizes the Start of a Number
+func IsNumber(r rune) bool {
+	return number.IsStart(r)
+}
+
 // IsAlNum Recognizes an Alphanumeric Character
 func IsAlNum(r rune) bool {
 	return IsAlpha(r) || IsDigit(r)
@@ -60,32 +66,18 @@ func GetName() string {
 
 // GetNumber Gets a Number
 func GetNumber() string {
-	n := ""
-	if !IsDigit(input.Look) {
-		errors.Expected("Integer")
-	}
-	for IsDigit(input.Look) {
-		n += string(input.Look)
-		input.GetChar()
-	}
-	return n
+	return strconv.FormatInt(GetNumberAsWord(), 10)
 }
 
-// GetNumberAsLongInt Gets a Number (integer version)
-// Note that this function is not actively called in the tutorial, and is
-// merely documentation for a possible implementation as the tutorial suggests.
-func GetNumberAsLongInt() (n int64) {
-	n = 0
-	if !IsDigit(input.Look) {
-		errors.Expected("Integer")
+// GetNumberAsWord Gets a Number (integer version)
+// This is the tutorial's GetNumberAsLongInt, which it only suggests as a
+// possible implementation. The value is checked against a word, as that is
+// what LoadConstant loads it into.
+func GetNumberAsWord() int64 {
+	n, err := number.Scan(func() rune { return input.Look }, input.GetChar,
+		number.Word)
+	if err != nil {
+		errors.Error(err.Error())
 	}
-	for IsDigit(input.Look) {
-		digit, err := strconv.Atoi(string(input.Look))
-		if err != nil {
-			panic(err)
-		}
-		n = 10*n + int64(digit)
-		input.GetChar()
-	}
-	return
+	return n
 }
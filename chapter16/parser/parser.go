@@ -13,7 +13,7 @@ func Factor() {
 		scanner.Match('(')
 		Expression()
 		scanner.Match(')')
-	} else if scanner.IsDigit(input.Look) {
+	} else if scanner.IsNumber(input.Look) {
 		codegen.LoadConstant(scanner.GetNumber())
 	} else if scanner.IsAlpha(input.Look) {
 		codegen.LoadVariable(scanner.GetName())
@@ -0,0 +1,58 @@
+// Command tokens prints the token stream of a KISS or TINY source file, one
+// token per line, without running a chapter:
+//
+//	go run ./cmd/tokens kiss|tiny <file>
+//
+// It lives apart from the chapter runner so that it never starts the
+// terminal screen or reads the keyboard.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	kisstokens "github.com/dcw303/crenshaw-go/chapter07/tokens"
+	tinytokens "github.com/dcw303/crenshaw-go/chapter12b/tokens"
+)
+
+func main() {
+	os.Exit(dumpTokens(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// dumpTokens prints one line per token of a KISS or TINY source file
+func dumpTokens(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 2 || (args[0] != "kiss" && args[0] != "tiny") {
+		fmt.Fprintln(stderr, "usage: tokens kiss|tiny <file>")
+		return 2
+	}
+	f, err := os.Open(args[1])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer f.Close()
+
+	if args[0] == "kiss" {
+		s := kisstokens.NewScanner(f)
+		defer s.Close()
+		for s.Next() {
+			t := s.Token()
+			fmt.Fprintf(stdout, "%s\t%-10s %s\n", t.Pos, t.Kind, t.Text)
+		}
+		err = s.Err()
+	} else {
+		s := tinytokens.NewScanner(f)
+		defer s.Close()
+		for s.Next() {
+			t := s.Token()
+			fmt.Fprintf(stdout, "%s\t%-10s %s\n", t.Pos, t.Kind, t.Text)
+		}
+		err = s.Err()
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
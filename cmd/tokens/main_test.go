@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSource(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "src.txt")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDumpTokens(t *testing.T) {
+	tests := []struct {
+		lang string
+		src  string
+		want []string
+	}{
+		{"kiss", "begin\n  x = 1\nend.\n", []string{
+			"1:1\tIdent      begin",
+			"2:3\tIdent      x",
+			"2:5\tOperator   =",
+			"2:7\tNumber     1",
+			"3:1\tEndSym     end",
+		}},
+		{"tiny", "program\nvar a;\nbegin\n a = 1;\nend.\n", []string{
+			"1:1\tIdent      program",
+			"2:1\tVar        var",
+			"2:5\tIdent      a",
+			"2:6\tOperator   ;",
+			"3:1\tIdent      begin",
+			"4:2\tIdent      a",
+			"4:4\tOperator   =",
+			"4:6\tNumber     1",
+			"4:7\tOperator   ;",
+			"5:1\tEnd        end",
+			"5:4\tOperator   .",
+		}},
+	}
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		code := dumpTokens([]string{tt.lang, writeSource(t, tt.src)}, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("%s: exit %d, stderr %q", tt.lang, code, stderr.String())
+		}
+		got := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.lang, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestDumpTokensErrors(t *testing.T) {
+	var stdout, stderr strings.Builder
+	if code := dumpTokens([]string{"pascal", "x"}, &stdout, &stderr); code != 2 {
+		t.Errorf("bad language: exit %d, want 2", code)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+	if code := dumpTokens([]string{"tiny", missing}, &stdout, &stderr); code != 1 {
+		t.Errorf("missing file: exit %d, want 1", code)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+}
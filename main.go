@@ -20,6 +20,14 @@ import (
 // chapter 14: types
 // chapter 15/16: test
 
+//3. Optionally, for chapters 05 and 12b, set CFGFile on the package to write
+//   the control flow graph of the compiled program as a Graphviz DOT file.
+
+//4. Alternatively, print the token stream of a source file without running a
+//   chapter at all:
+//
+//   go run ./cmd/tokens kiss|tiny <file>
+
 func main() {
 	defer termbox.Close()
 	defer closeLoop()
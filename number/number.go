@@ -0,0 +1,162 @@
+// Package number scans the numeric literals shared by the scanners of every
+// chapter, so that they all agree on the forms a number can take:
+//
+//	123, 1_000       decimal, with optional _ separators between digits
+//	$FF, 0xFF        hexadecimal
+//	%1010, 0b1010    binary
+//	0o17             octal
+//	'A'              the character code of A, with \n \t \r \0 \' and \\
+//
+// A literal is checked against the size of the target word as it is read.
+package number
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Word Sizes of the Target, in Bits
+const (
+	Byte = 8
+	Word = 16
+	Long = 32
+)
+
+// ErrExpected is Returned when the Input Doesn't Start a Number
+var ErrExpected = errors.New("Integer Expected")
+
+// ErrOverflow is Returned when a Literal Doesn't Fit the Target Word
+var ErrOverflow = errors.New("Integer Overflow")
+
+// IsStart Recognizes the First Character of a Numeric Literal
+func IsStart(r rune) bool {
+	return unicode.IsDigit(r) || r == '$' || r == '%' || r == '\''
+}
+
+// digitValue returns the value of a digit in any radix up to 16, or -1
+func digitValue(r rune) int {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r - '0')
+	case r >= 'a' && r <= 'f':
+		return int(r-'a') + 10
+	case r >= 'A' && r <= 'F':
+		return int(r-'A') + 10
+	}
+	return -1
+}
+
+// Scan Reads a Numeric Literal
+// look returns the lookahead character and next advances it. The value must
+// fit in an unsigned word of the given number of bits; negation is left to the
+// caller.
+func Scan(look func() rune, next func(), bits int) (int64, error) {
+	limit := uint64(1)<<uint(bits) - 1
+	if !IsStart(look()) {
+		return 0, ErrExpected
+	}
+	if look() == '\'' {
+		return char(look, next, limit)
+	}
+	radix := uint64(10)
+	switch look() {
+	case '$':
+		radix = 16
+		next()
+	case '%':
+		radix = 2
+		next()
+	case '0':
+		next()
+		switch unicode.ToLower(look()) {
+		case 'x':
+			radix = 16
+			next()
+		case 'b':
+			radix = 2
+			next()
+		case 'o':
+			radix = 8
+			next()
+		default:
+			// a leading zero is just a decimal digit
+			return digits(look, next, radix, limit, 0, true)
+		}
+	}
+	return digits(look, next, radix, limit, 0, false)
+}
+
+// Negate Negates a Literal Read by Scan
+// The result must fit in a signed word of the given number of bits, which
+// holds one more negative value than positive.
+func Negate(val int64, bits int) (int64, error) {
+	if val > int64(1)<<uint(bits-1) {
+		return 0, ErrOverflow
+	}
+	return -val, nil
+}
+
+// digits reads the digits of a literal in the given radix
+// seen reports whether a digit has already been read.
+func digits(look func() rune, next func(), radix uint64, limit uint64,
+	val uint64, seen bool) (int64, error) {
+	sep := false
+	for {
+		r := look()
+		if r == '_' && seen {
+			sep = true
+			next()
+			continue
+		}
+		d := digitValue(r)
+		if d < 0 || uint64(d) >= radix {
+			if unicode.IsDigit(r) || (radix == 16 && unicode.IsLetter(r)) {
+				return 0, errors.New("Invalid Digit " + strconv.QuoteRune(r) +
+					" in Base " + strconv.Itoa(int(radix)))
+			}
+			break
+		}
+		val = val*radix + uint64(d)
+		if val > limit {
+			return 0, ErrOverflow
+		}
+		seen = true
+		sep = false
+		next()
+	}
+	if !seen {
+		return 0, ErrExpected
+	}
+	if sep {
+		return 0, errors.New("Digit Expected After _")
+	}
+	return int64(val), nil
+}
+
+// char reads a quoted character constant
+func char(look func() rune, next func(), limit uint64) (int64, error) {
+	next()
+	r := look()
+	switch r {
+	case '\'', 0x0D, 0x1A:
+		return 0, errors.New("Character Expected")
+	case '\\':
+		next()
+		i := strings.IndexRune(`nrt0\'`, look())
+		if i < 0 {
+			return 0, errors.New("Invalid Escape \\" + string(look()))
+		}
+		r = []rune{'\n', '\r', '\t', 0, '\\', '\''}[i]
+	}
+	next()
+	if look() != '\'' {
+		return 0, errors.New("' Expected")
+	}
+	next()
+	if uint64(r) > limit {
+		return 0, ErrOverflow
+	}
+	return int64(r), nil
+}
@@ -0,0 +1,105 @@
+package number
+
+import "testing"
+
+// scan runs Scan over a string, returning the value and what is left unread
+func scan(src string, bits int) (int64, string, error) {
+	r := []rune(src + "\x1a")
+	i := 0
+	val, err := Scan(func() rune { return r[i] }, func() { i++ }, bits)
+	return val, string(r[i : len(r)-1]), err
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src  string
+		bits int
+		want int64
+		rest string
+	}{
+		{"0", Word, 0, ""},
+		{"123+", Word, 123, "+"},
+		{"1_000", Word, 1000, ""},
+		{"65535", Word, 65535, ""},
+		{"$FF", Word, 255, ""},
+		{"$ff;", Word, 255, ";"},
+		{"0x1F", Word, 31, ""},
+		{"%1010", Word, 10, ""},
+		{"0b11", Word, 3, ""},
+		{"0o17", Word, 15, ""},
+		{"017", Word, 17, ""},
+		{"'A'", Word, 65, ""},
+		{`'\n'`, Word, 10, ""},
+		{`'\''`, Word, 39, ""},
+		{"255", Byte, 255, ""},
+		{"70000", Long, 70000, ""},
+		{"$FFFFFFFF", Long, 1<<32 - 1, ""},
+	}
+	for _, tt := range tests {
+		got, rest, err := scan(tt.src, tt.bits)
+		if err != nil {
+			t.Errorf("Scan(%q) error: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want || rest != tt.rest {
+			t.Errorf("Scan(%q) = %d leaving %q, want %d leaving %q", tt.src, got,
+				rest, tt.want, tt.rest)
+		}
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		bits int
+		want string
+	}{
+		{"x", Word, ErrExpected.Error()},
+		{"$", Word, ErrExpected.Error()},
+		{"65536", Word, ErrOverflow.Error()},
+		{"256", Byte, ErrOverflow.Error()},
+		{"$10000", Word, ErrOverflow.Error()},
+		{"12a", Word, ""},
+		{"%102", Word, "Invalid Digit '2' in Base 2"},
+		{"0o8", Word, "Invalid Digit '8' in Base 8"},
+		{"$FG", Word, "Invalid Digit 'G' in Base 16"},
+		{"1_", Word, "Digit Expected After _"},
+		{"''", Word, "Character Expected"},
+		{"'ab'", Word, "' Expected"},
+		{`'\q'`, Word, `Invalid Escape \q`},
+	}
+	for _, tt := range tests {
+		_, _, err := scan(tt.src, tt.bits)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("Scan(%q) error = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestNegate(t *testing.T) {
+	tests := []struct {
+		val  int64
+		bits int
+		want int64
+		ok   bool
+	}{
+		{0, Word, 0, true},
+		{1, Word, -1, true},
+		{32767, Word, -32767, true},
+		{32768, Word, -32768, true},
+		{32769, Word, 0, false},
+		{65535, Word, 0, false},
+		{128, Byte, -128, true},
+		{129, Byte, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := Negate(tt.val, tt.bits)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("Negate(%d, %d) = %d, %v", tt.val, tt.bits, got, err)
+		}
+	}
+}
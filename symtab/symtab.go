@@ -0,0 +1,134 @@
+// Package symtab is a symbol table for the compilers in the later chapters.
+// Names are hashed, so lookups don't slow down as the program grows, and there
+// is no limit on the number of entries. Scopes nest: a name declared in an
+// inner scope hides the same name in the scopes around it until the inner
+// scope is popped.
+package symtab
+
+import "errors"
+
+// Kind is the Kind of Thing a Symbol Names
+type Kind rune
+
+// Symbol Kinds
+const (
+	Var   Kind = 'v'
+	Param Kind = 'f'
+	Proc  Kind = 'p'
+	Func  Kind = 'F'
+	Const Kind = 'c'
+)
+
+// String Returns the Name of a Kind
+func (k Kind) String() string {
+	switch k {
+	case Var:
+		return "Variable"
+	case Param:
+		return "Parameter"
+	case Proc:
+		return "Procedure"
+	case Func:
+		return "Function"
+	case Const:
+		return "Constant"
+	}
+	return "Kind(" + string(k) + ")"
+}
+
+// ErrDuplicate is Returned when a Name is Declared Twice in One Scope
+var ErrDuplicate = errors.New("Duplicate Identifier")
+
+// Entry is a Symbol Table Entry
+type Entry struct {
+	Name   string
+	Kind   Kind
+	Type   rune   // the type code used by the compiler, if it has types
+	Offset int    // storage offset, for parameters and locals
+	Size   int    // number of elements, for arrays
+	ByRef  bool   // passed by reference, for parameters
+	Reg    string // register holding the parameter, if it is passed in one
+	Level  int    // scope depth the name was declared at; 0 is global
+	Line   int    // where the name was declared
+	Col    int
+	// Params are the formal parameters, for procedures and functions
+	Params []*Entry
+	// Forward is set for a procedure declared FORWARD and not yet defined
+	Forward bool
+}
+
+// scope is one level of nesting
+type scope struct {
+	names map[string]*Entry
+	order []*Entry
+}
+
+// Table is a Stack of Scopes
+type Table struct {
+	scopes []*scope
+}
+
+// New Creates a Table Holding Only the Global Scope
+func New() *Table {
+	t := &Table{}
+	t.Push()
+	return t
+}
+
+// Push Opens a New Innermost Scope
+func (t *Table) Push() {
+	t.scopes = append(t.scopes, &scope{names: make(map[string]*Entry)})
+}
+
+// Pop Closes the Innermost Scope, Dropping its Names
+// The global scope is never popped.
+func (t *Table) Pop() {
+	if len(t.scopes) > 1 {
+		t.scopes = t.scopes[:len(t.scopes)-1]
+	}
+}
+
+// Level Returns the Depth of the Innermost Scope
+func (t *Table) Level() int {
+	return len(t.scopes) - 1
+}
+
+// Add Declares a Name in the Innermost Scope
+// The entry's Level is filled in by Add.
+func (t *Table) Add(e Entry) (*Entry, error) {
+	s := t.scopes[len(t.scopes)-1]
+	if _, ok := s.names[e.Name]; ok {
+		return nil, ErrDuplicate
+	}
+	e.Level = t.Level()
+	p := &e
+	s.names[e.Name] = p
+	s.order = append(s.order, p)
+	return p, nil
+}
+
+// Lookup Finds the Innermost Declaration of a Name
+func (t *Table) Lookup(name string) (*Entry, bool) {
+	for i := len(t.scopes) - 1; i >= 0; i-- {
+		if e, ok := t.scopes[i].names[name]; ok {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// LookupLocal Finds a Name in the Innermost Scope Only
+func (t *Table) LookupLocal(name string) (*Entry, bool) {
+	e, ok := t.scopes[len(t.scopes)-1].names[name]
+	return e, ok
+}
+
+// Entries Returns the Names of the Innermost Scope in Declaration Order
+func (t *Table) Entries() []*Entry {
+	return t.scopes[len(t.scopes)-1].order
+}
+
+// Len Returns the Number of Names in the Innermost Scope
+func (t *Table) Len() int {
+	return len(t.scopes[len(t.scopes)-1].order)
+}
@@ -0,0 +1,121 @@
+package symtab
+
+import "testing"
+
+func TestScopes(t *testing.T) {
+	st := New()
+	add := func(name string, kind Kind) *Entry {
+		t.Helper()
+		e, err := st.Add(Entry{Name: name, Kind: kind})
+		if err != nil {
+			t.Fatalf("Add(%s) error: %v", name, err)
+		}
+		return e
+	}
+	add("A", Var)
+	add("P", Proc)
+	st.Push()
+	add("A", Param)
+	add("B", Var)
+	st.Push()
+	add("C", Var)
+
+	tests := []struct {
+		name  string
+		kind  Kind
+		level int
+		found bool
+	}{
+		{"A", Param, 1, true},
+		{"B", Var, 1, true},
+		{"C", Var, 2, true},
+		{"P", Proc, 0, true},
+		{"D", 0, 0, false},
+	}
+	for _, tt := range tests {
+		e, ok := st.Lookup(tt.name)
+		if ok != tt.found {
+			t.Errorf("Lookup(%s) found = %v, want %v", tt.name, ok, tt.found)
+			continue
+		}
+		if ok && (e.Kind != tt.kind || e.Level != tt.level) {
+			t.Errorf("Lookup(%s) = %v at level %d, want %v at level %d", tt.name,
+				e.Kind, e.Level, tt.kind, tt.level)
+		}
+	}
+	if _, ok := st.LookupLocal("A"); ok {
+		t.Errorf("LookupLocal(A) found an outer name")
+	}
+
+	st.Pop()
+	st.Pop()
+	if e, _ := st.Lookup("A"); e.Kind != Var {
+		t.Errorf("after Pop, A is a %v, want a %v", e.Kind, Var)
+	}
+	if _, ok := st.Lookup("B"); ok {
+		t.Errorf("after Pop, B is still declared")
+	}
+	st.Pop()
+	if st.Level() != 0 || st.Len() != 2 {
+		t.Errorf("popping the global scope: level %d with %d names", st.Level(),
+			st.Len())
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	tests := []struct {
+		names []string
+		push  int // names declared before a new scope is pushed
+		err   error
+	}{
+		{[]string{"A", "B"}, -1, nil},
+		{[]string{"A", "A"}, -1, ErrDuplicate},
+		{[]string{"A", "A"}, 1, nil},
+	}
+	for _, tt := range tests {
+		st := New()
+		var err error
+		for i, n := range tt.names {
+			if i == tt.push {
+				st.Push()
+			}
+			_, err = st.Add(Entry{Name: n})
+		}
+		if err != tt.err {
+			t.Errorf("declaring %v (push at %d): error = %v, want %v", tt.names,
+				tt.push, err, tt.err)
+		}
+	}
+}
+
+func TestEntriesOrder(t *testing.T) {
+	st := New()
+	names := []string{"Z", "A", "M"}
+	for _, n := range names {
+		st.Add(Entry{Name: n})
+	}
+	for i, e := range st.Entries() {
+		if e.Name != names[i] {
+			t.Errorf("Entries()[%d] = %s, want %s", i, e.Name, names[i])
+		}
+	}
+}
+
+func TestKindString(t *testing.T) {
+	tests := []struct {
+		k    Kind
+		want string
+	}{
+		{Var, "Variable"},
+		{Param, "Parameter"},
+		{Proc, "Procedure"},
+		{Func, "Function"},
+		{Const, "Constant"},
+		{'x', "Kind(x)"},
+	}
+	for _, tt := range tests {
+		if got := tt.k.String(); got != tt.want {
+			t.Errorf("Kind(%q).String() = %q, want %q", rune(tt.k), got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package util
 
-import "github.com/nsf/termbox-go"
+import (
+	"io"
+	"sync"
+
+	"github.com/nsf/termbox-go"
+)
 
 var width int
 var height int
@@ -9,6 +14,16 @@ var yPos int
 
 var screenMap = make(map[int][]rune)
 
+// Tee receives a copy of everything written to the screen, if set
+var Tee io.Writer
+
+// Screen is written instead of the screen, if set
+var Screen io.Writer
+
+// Source is read instead of the keyboard, if set. Line breaks are returned as
+// a CR and the end of the input as a Ctrl-Z, just as they are typed.
+var Source io.RuneReader
+
 func incrementLine() {
 	xPos = 0
 	if yPos == height-1 {
@@ -23,21 +38,30 @@ func incrementLine() {
 	}
 }
 
-func init() {
-	err := termbox.Init()
-	if err != nil {
-		panic(err)
-	}
-	width, height = termbox.Size()
+var initOnce sync.Once
 
-	for i := 0; i < height; i++ {
-		screenMap[i] = make([]rune, width)
-	}
+// initScreen starts termbox on first use rather than at package init, so that
+// packages which import util can also be used as libraries without a terminal
+func initScreen() {
+	initOnce.Do(func() {
+		err := termbox.Init()
+		if err != nil {
+			panic(err)
+		}
+		width, height = termbox.Size()
 
+		for i := 0; i < height; i++ {
+			screenMap[i] = make([]rune, width)
+		}
+	})
 }
 
 // Read reads a single character from stdin into a rune
 func Read() (out rune) {
+	if Source != nil {
+		return readSource()
+	}
+	initScreen()
 	for {
 		if ev := termbox.PollEvent(); ev.Type == termbox.EventKey {
 			switch ev.Key {
@@ -58,6 +82,21 @@ func Read() (out rune) {
 	return
 }
 
+// readSource reads a single character from Source
+func readSource() rune {
+	for {
+		r, _, err := Source.ReadRune()
+		switch {
+		case err != nil:
+			return 0x1A
+		case r == 0x0A:
+			return 0x0D
+		case r != 0x0D:
+			return r
+		}
+	}
+}
+
 // WriteBlankLine Writes a blank line to stdout
 func WriteBlankLine() {
 	Write(string(0x0D))
@@ -70,6 +109,14 @@ func WriteLine(output string) {
 
 // Write writes a string to stdout
 func Write(output string) {
+	if Tee != nil {
+		io.WriteString(Tee, output)
+	}
+	if Screen != nil {
+		io.WriteString(Screen, output)
+		return
+	}
+	initScreen()
 
 	for _, r := range output {
 